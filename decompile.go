@@ -0,0 +1,488 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// decompiler reads back the structures of a program produced by Filter.Compile
+type decompiler struct {
+	instructions []bpf.Instruction
+	raw          []bpf.RawInstruction
+	arch         string
+	// section is the architecture of the section being decoded
+	section string
+}
+
+// returnedDecision is the Decision of a returned value, kept as is even if unknown
+func returnedDecision(ret uint32) Decision {
+	return Decision{Type: DecisionType(ret & 0xffff0000), Data: uint16(ret)}
+}
+
+func anyArgs() [6]SyscallArgument {
+	var args [6]SyscallArgument
+	for i := range args {
+		args[i] = Any()
+	}
+	return args
+}
+
+// follow returns the position reached from pc through unconditional jumps
+func (d *decompiler) follow(pc int) (int, error) {
+	for pc < len(d.instructions) {
+		jump, ok := d.instructions[pc].(bpf.Jump)
+		if !ok {
+			return pc, nil
+		}
+		pc += 1 + int(jump.Skip)
+	}
+	return 0, fmt.Errorf("jump out of the program")
+}
+
+// load returns the seccomp data field loaded at pc and whether it is its high 32 bits
+func (d *decompiler) load(pc int) (string, bool, bool) {
+	load, ok := d.instructions[pc].(bpf.LoadAbsolute)
+	if !ok || load.Size != 4 {
+		return "", false, false
+	}
+	return lowlevel.SeccompDataField(load.Off, d.arch)
+}
+
+// ret returns the Decision returned at pc, if any
+func (d *decompiler) ret(pc int) (Decision, bool) {
+	ret, ok := d.instructions[pc].(bpf.RetConstant)
+	return returnedDecision(ret.Val), ok
+}
+
+// test decodes the conditional jump at pc as an equal, greater than, greater or
+// equal or bits set test, and returns the targets of its outcomes.
+func (d *decompiler) test(pc int) (bpf.JumpTest, uint32, int, int, error) {
+	jump, ok := d.instructions[pc].(bpf.JumpIf)
+	if !ok {
+		return 0, 0, 0, 0, fmt.Errorf("instruction %d: expected a conditional jump", pc)
+	}
+	cond, skipTrue, skipFalse := jump.Cond, jump.SkipTrue, jump.SkipFalse
+	negated := map[bpf.JumpTest]bpf.JumpTest{
+		bpf.JumpNotEqual:    bpf.JumpEqual,
+		bpf.JumpLessOrEqual: bpf.JumpGreaterThan,
+		bpf.JumpLessThan:    bpf.JumpGreaterOrEqual,
+		bpf.JumpBitsNotSet:  bpf.JumpBitsSet,
+	}
+	if test, ok := negated[cond]; ok {
+		cond, skipTrue, skipFalse = test, skipFalse, skipTrue
+	}
+	onTrue, err := d.follow(pc + 1 + int(skipTrue))
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("instruction %d: %w", pc, err)
+	}
+	onFalse, err := d.follow(pc + 1 + int(skipFalse))
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("instruction %d: %w", pc, err)
+	}
+	return cond, jump.Val, onTrue, onFalse, nil
+}
+
+// matches tells if the instructions assemble to the raw ones
+func matches(raw []bpf.RawInstruction, instructions []bpf.Instruction) bool {
+	for i, instruction := range instructions {
+		assembled, err := instruction.Assemble()
+		if err != nil || assembled != raw[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argument decodes the check of the argument at the given index starting at pc,
+// by matching it against the instructions compiled for each possible operator.
+// It returns the SyscallArgument and the check length.
+func (d *decompiler) argument(pc int, index int) (SyscallArgument, int, error) {
+	raw := d.raw[pc:]
+	k := func(i int) uint64 {
+		if i < len(raw) {
+			return uint64(raw[i].K)
+		}
+		return 0
+	}
+	var candidates []SyscallArgument
+	_, high, _ := d.load(pc)
+	switch {
+	case !lowlevel.ArchIs64Bits(d.section):
+		for _, op := range []Operator{OpEqual, OpNotEqual, OpLessThan, OpLessOrEqual, OpGreaterThan, OpGreaterOrEqual} {
+			candidates = append(candidates, SyscallArgument{Value: uintptr(k(1)), Op: op})
+		}
+		candidates = append(candidates, MaskedEqual(uintptr(k(1)), uintptr(k(2))))
+	case high:
+		// Ordered comparisons start with the high word
+		value := uintptr(k(1)<<32 | k(4))
+		for _, op := range []Operator{OpLessThan, OpLessOrEqual, OpGreaterThan, OpGreaterOrEqual} {
+			candidates = append(candidates, SyscallArgument{Value: value, Op: op})
+		}
+	default:
+		value := uintptr(k(3)<<32 | k(1))
+		candidates = append(
+			candidates,
+			Equal(value),
+			NotEqual(value),
+			MaskedEqual(uintptr(k(4)<<32|k(1)), uintptr(k(5)<<32|k(2))),
+		)
+	}
+	for _, candidate := range candidates {
+		length := len(candidate.compile(index, 0, d.section))
+		if length > len(raw) {
+			continue
+		}
+		// Checks end with the jump leaving on mismatch
+		distance := uint(raw[length-1].Jt) + uint(raw[length-1].Jf)
+		if matches(raw, candidate.compile(index, distance, d.section)) {
+			return candidate, length, nil
+		}
+	}
+	return SyscallArgument{}, 0, fmt.Errorf("instruction %d: unknown argument check", pc)
+}
+
+// args decodes the arguments checks starting at pc, and returns the position
+// following them.
+func (d *decompiler) args(pc int) ([6]SyscallArgument, int, error) {
+	args := anyArgs()
+	start := pc
+	for pc < len(d.instructions) {
+		field, _, ok := d.load(pc)
+		if !ok || !strings.HasPrefix(field, "Arg") {
+			break
+		}
+		index := int(field[3] - '0')
+		if !args[index].isAny {
+			return args, 0, fmt.Errorf("instruction %d: argument %d is checked twice", pc, index)
+		}
+		arg, length, err := d.argument(pc, index)
+		if err != nil {
+			return args, 0, err
+		}
+		args[index] = arg
+		pc += length
+	}
+	if pc == start || pc >= len(d.instructions) {
+		return args, 0, fmt.Errorf("instruction %d: expected arguments checks", start)
+	}
+	return args, pc, nil
+}
+
+// linear decodes elements compiled one after the other, see FilterElement.compile.
+// The matches of an element are compiled in reverse order before its decision.
+func (d *decompiler) linear(pc int) ([]FilterElement, Decision, error) {
+	var elements []FilterElement
+	element, elementAt := FilterElement{}, -1
+	flush := func() {
+		if len(element.Match) == 0 {
+			return
+		}
+		for i, j := 0, len(element.Match)-1; i < j; i, j = i+1, j-1 {
+			element.Match[i], element.Match[j] = element.Match[j], element.Match[i]
+		}
+		elements = append(elements, element)
+	}
+	for {
+		if defaultDecision, ok := d.ret(pc); ok {
+			flush()
+			return elements, defaultDecision, nil
+		}
+		cond, number, onTrue, onFalse, err := d.test(pc)
+		if err != nil {
+			return nil, Decision{}, err
+		}
+		if cond != bpf.JumpEqual {
+			return nil, Decision{}, fmt.Errorf("instruction %d: expected a syscall number check", pc)
+		}
+		filter := SyscallCallFilter{Number: uint(number), Args: anyArgs()}
+		decisionAt := onTrue
+		if _, ok := d.ret(onTrue); !ok {
+			// Arguments checks are followed by a jump to the decision
+			var end int
+			filter.Args, end, err = d.args(onTrue)
+			if err != nil {
+				return nil, Decision{}, err
+			}
+			if _, ok := d.instructions[end].(bpf.Jump); !ok {
+				return nil, Decision{}, fmt.Errorf("instruction %d: expected a jump to the decision", end)
+			}
+			if decisionAt, err = d.follow(end); err != nil {
+				return nil, Decision{}, err
+			}
+		}
+		decision, ok := d.ret(decisionAt)
+		if !ok {
+			return nil, Decision{}, fmt.Errorf("instruction %d: expected a decision", decisionAt)
+		}
+		if decisionAt != elementAt {
+			flush()
+			element, elementAt = FilterElement{Decision: decision}, decisionAt
+		}
+		element.Match = append(element.Match, filter)
+		pc = onFalse
+	}
+}
+
+// tree decodes a binary decision tree on the syscall number, see compileTree.
+// The rules are returned in the syscall numbers order.
+func (d *decompiler) tree(pc int) ([]syscallRule, Decision, error) {
+	if defaultDecision, ok := d.ret(pc); ok {
+		return nil, defaultDecision, nil
+	}
+	cond, number, onTrue, onFalse, err := d.test(pc)
+	if err != nil {
+		return nil, Decision{}, err
+	}
+	switch cond {
+	case bpf.JumpGreaterThan:
+		left, defaultDecision, err := d.tree(onFalse)
+		if err != nil {
+			return nil, Decision{}, err
+		}
+		right, rightDefault, err := d.tree(onTrue)
+		if err != nil {
+			return nil, Decision{}, err
+		}
+		if rightDefault != defaultDecision {
+			return nil, Decision{}, fmt.Errorf("instruction %d: default decisions differ", pc)
+		}
+		return append(left, right...), defaultDecision, nil
+	case bpf.JumpEqual:
+		defaultDecision, ok := d.ret(onFalse)
+		if !ok {
+			return nil, Decision{}, fmt.Errorf("instruction %d: expected the default decision", onFalse)
+		}
+		var rules []syscallRule
+		for at := onTrue; at < onFalse; at++ {
+			filter := SyscallCallFilter{Number: uint(number), Args: anyArgs()}
+			if _, ok := d.ret(at); !ok {
+				if filter.Args, at, err = d.args(at); err != nil {
+					return nil, Decision{}, err
+				}
+			}
+			decision, ok := d.ret(at)
+			if !ok {
+				return nil, Decision{}, fmt.Errorf("instruction %d: expected a decision", at)
+			}
+			rules = append(rules, syscallRule{filter, decision})
+			if filter.Args == anyArgs() {
+				// Next rules are unreachable
+				break
+			}
+		}
+		return rules, defaultDecision, nil
+	default:
+		return nil, Decision{}, fmt.Errorf("instruction %d: expected a syscall number check", pc)
+	}
+}
+
+// body decodes the checks of the elements starting with the syscall number loaded,
+// as compiled by compileElements.
+func (d *decompiler) body(pc int) ([]FilterElement, Decision, error) {
+	if cond, _, _, _, err := d.test(pc); err != nil || cond != bpf.JumpGreaterThan {
+		elements, defaultDecision, err := d.linear(pc)
+		if err == nil {
+			return elements, defaultDecision, nil
+		}
+		// A tree with a single syscall number only has a leaf
+		if _, ok := d.instructions[pc].(bpf.JumpIf); !ok {
+			return nil, Decision{}, err
+		}
+	}
+	rules, defaultDecision, err := d.tree(pc)
+	if err != nil {
+		return nil, Decision{}, err
+	}
+	var elements []FilterElement
+	for i, rule := range rules {
+		if i == 0 || rule.decision != rules[i-1].decision {
+			elements = append(elements, FilterElement{Decision: rule.decision})
+		}
+		last := &elements[len(elements)-1]
+		last.Match = append(last.Match, rule.filter)
+	}
+	return elements, defaultDecision, nil
+}
+
+// sortedRules returns the rules of the elements sorted by syscall number, the
+// rules of a syscall number being kept in order.
+func sortedRules(elements []FilterElement) []syscallRule {
+	var rules []syscallRule
+	for _, element := range elements {
+		for _, filter := range element.Match {
+			rules = append(rules, syscallRule{filter, element.Decision})
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].filter.Number < rules[j].filter.Number })
+	return rules
+}
+
+// decodeSection decodes the section of an architecture starting at pc, see
+// Filter.compileArch. The x32 policy is decoded on amd64, and the elements of
+// secondary architectures which aren't the translated Elements become ArchElements.
+func (d *decompiler) decodeSection(f *Filter, arch string, pc int) error {
+	d.section = arch
+	if field, _, ok := d.load(pc); !ok || field != "Number" {
+		return fmt.Errorf("instruction %d: expected the syscall number load", pc)
+	}
+	body, err := d.follow(pc + 1)
+	if err != nil {
+		return err
+	}
+	var x32 int
+	if arch == "amd64" {
+		cond, val, onTrue, onFalse, err := d.test(body)
+		if err != nil {
+			return err
+		}
+		if cond == bpf.JumpEqual && val == skippedSyscall {
+			// The skipped syscall goes to the native rules, after the x32 check
+			native := onTrue
+			if cond, val, onTrue, onFalse, err = d.test(onFalse); err != nil {
+				return err
+			}
+			if onFalse != native {
+				return fmt.Errorf("instruction %d: expected the skipped syscall to reach the native rules", body)
+			}
+		}
+		if cond != bpf.JumpBitsSet || val != lowlevel.X32_SYSCALL_BIT {
+			return fmt.Errorf("instruction %d: expected the x32 syscall bit check", body)
+		}
+		x32, body = onTrue, onFalse
+	}
+	if arch == f.Architecture {
+		if f.Elements, f.DefaultDecision, err = d.body(body); err != nil {
+			return err
+		}
+	} else {
+		elements, defaultDecision, err := d.body(body)
+		if err != nil {
+			return err
+		}
+		if defaultDecision != f.DefaultDecision {
+			return fmt.Errorf("instruction %d: '%s' default decision differs", body, arch)
+		}
+		// Rules which aren't the translated Elements are ArchElements
+		translated, err := f.elementsFor(arch)
+		if err != nil || !reflect.DeepEqual(sortedRules(translated), sortedRules(elements)) {
+			if f.ArchElements == nil {
+				f.ArchElements = make(map[string][]FilterElement)
+			}
+			f.ArchElements[arch] = elements
+		}
+	}
+	if arch != "amd64" {
+		return nil
+	}
+	if decision, ok := d.ret(x32); ok && decision == f.badArchDecision() {
+		f.X32Policy = X32Deny
+		return nil
+	}
+	elements, defaultDecision, err := d.body(x32)
+	if err != nil {
+		return err
+	}
+	if defaultDecision != f.DefaultDecision {
+		return fmt.Errorf("instruction %d: x32 default decision differs", x32)
+	}
+	f.X32Policy = X32Rules
+	f.X32Elements = elements
+	if arch != f.Architecture {
+		return nil
+	}
+	native, err := f.elementsFor("x32")
+	if err == nil && reflect.DeepEqual(sortedRules(native), sortedRules(elements)) {
+		f.X32Policy = X32Native
+		f.X32Elements = nil
+	}
+	return nil
+}
+
+// filter decodes the architecture dispatch and the sections, see Filter.compile
+func (d *decompiler) filter() (*Filter, error) {
+	if field, _, ok := d.load(0); !ok || field != "Arch" {
+		return nil, fmt.Errorf("instruction 0: expected the architecture load")
+	}
+	var archs []string
+	var sections []int
+	f := &Filter{}
+	for pc := 1; ; {
+		var err error
+		if pc, err = d.follow(pc); err != nil {
+			return nil, err
+		}
+		if decision, ok := d.ret(pc); ok {
+			f.BadArchDecision = &decision
+			break
+		}
+		cond, val, onTrue, onFalse, err := d.test(pc)
+		if err != nil {
+			return nil, err
+		}
+		arch, ok := lowlevel.GoArch(val)
+		if cond != bpf.JumpEqual || !ok {
+			return nil, fmt.Errorf("instruction %d: expected an architecture check", pc)
+		}
+		archs = append(archs, arch)
+		sections = append(sections, onTrue)
+		pc = onFalse
+	}
+	if len(archs) == 0 {
+		return nil, fmt.Errorf("no architecture is checked")
+	}
+	if lowlevel.ArchIsLittleEndian(archs[0]) != lowlevel.ArchIsLittleEndian(d.arch) {
+		return nil, fmt.Errorf("architecture '%s' endianness differs from '%s'", archs[0], d.arch)
+	}
+	f.Architecture, f.SecondaryArchitectures = archs[0], archs[1:]
+	for i, arch := range archs {
+		if err := d.decodeSection(f, arch, sections[i]); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Decompile decodes a seccomp program produced by [Filter.Compile] back into a
+// Filter, arch being the architecture the program runs on. The Filter takes the
+// same decisions as the program, but its Elements may be grouped and ordered
+// differently from the compiled ones, as the tree form only keeps the order of
+// the rules of each syscall number.
+//
+// An error is returned if the program isn't in a form produced by Filter.Compile,
+// or if it can't be checked to be equivalent to the decoded Filter, see [EquivalentPrograms].
+func Decompile(program []bpf.RawInstruction, arch string) (*Filter, error) {
+	if lowlevel.GetAuditArch(arch) == 0 {
+		return nil, fmt.Errorf("unknown architecture '%s'", arch)
+	}
+	instructions, allDecoded := bpf.Disassemble(program)
+	if !allDecoded {
+		return nil, fmt.Errorf("program contains unknown instructions")
+	}
+	if len(instructions) == 0 {
+		return nil, fmt.Errorf("empty program")
+	}
+	d := &decompiler{instructions: instructions, raw: program, arch: arch}
+	filter, err := d.filter()
+	if err != nil {
+		return nil, fmt.Errorf("program not compiled by goseccomp: %w", err)
+	}
+	compiled, err := filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	difference, err := equivalent(instructions, compiled, arch)
+	if err != nil {
+		return nil, err
+	}
+	if difference != nil {
+		return nil, fmt.Errorf("decompiled filter differs from the program on %+v", difference.Data)
+	}
+	return filter, nil
+}
@@ -0,0 +1,224 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// argumentsFilter checks a syscall argument with each operator
+func argumentsFilter(arch string) Filter {
+	// The values are uint64 for 32 bits hosts, where uintptr truncates them
+	values := []uint64{0x100000001, 0x200000010, 0x10, 0x100000000, 0xffffffff, 0x300000004, 0x100000004}
+	if !lowlevel.ArchIs64Bits(arch) {
+		// Only the low 32 bits are compiled
+		for i := range values {
+			values[i] = uint64(uint32(values[i]))
+		}
+	}
+	arguments := []SyscallArgument{
+		Equal(uintptr(values[0])), NotEqual(uintptr(values[0])),
+		LessThan(uintptr(values[1])), LessOrEqual(uintptr(values[2])),
+		GreaterThan(uintptr(values[3])), GreaterOrEqual(uintptr(values[4])),
+		MaskedEqual(uintptr(values[5]), uintptr(values[6])),
+	}
+	element := FilterElement{Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)}}
+	for i, argument := range arguments {
+		args := anyArgs()
+		args[i%6] = argument
+		element.Match = append(element.Match, SyscallCallFilter{Number: uint(i), Args: args})
+	}
+	return Filter{
+		Architecture:    arch,
+		Elements:        []FilterElement{element},
+		DefaultDecision: Decision{Type: Allow},
+	}
+}
+
+// treeFilter has enough rules for a tree with trampolines, on amd64, x32 and 386
+func treeFilter() Filter {
+	element := FilterElement{Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)}}
+	for number := uint(0); number < 100; number++ {
+		args := anyArgs()
+		args[0] = Equal(uintptr(number))
+		element.Match = append(element.Match, SyscallCallFilter{Number: number, Args: args})
+	}
+	// Some of the amd64 syscalls don't exist on 386
+	archElement := FilterElement{Decision: element.Decision}
+	for number := uint(1); number <= 100; number++ {
+		args := anyArgs()
+		args[0] = Equal(uintptr(number))
+		archElement.Match = append(archElement.Match, SyscallCallFilter{Number: number, Args: args})
+	}
+	return Filter{
+		Architecture:           "amd64",
+		SecondaryArchitectures: []string{"386"},
+		ArchElements:           map[string][]FilterElement{"386": {archElement}},
+		X32Policy:              X32Native,
+		Elements:               []FilterElement{element},
+		DefaultDecision:        Decision{Type: Allow},
+		BadArchDecision:        &Decision{Type: Trap},
+	}
+}
+
+type TestCasesDecompile struct {
+	filter Filter
+	// same tells if the Elements are decompiled as they are, the tree
+	// form only keeps the rules order for each syscall number
+	same bool
+}
+
+func TestDecompile(t *testing.T) {
+	multiArch := explainedFilter()
+	multiArch.SecondaryArchitectures = []string{"386"}
+	multiArch.X32Policy = X32Native
+	x32Rules := explainedFilter()
+	x32Rules.X32Policy = X32Rules
+	x32Rules.X32Elements = []FilterElement{
+		{
+			Match:    []SyscallCallFilter{{Number: unix.SYS_READ | lowlevel.X32_SYSCALL_BIT, Args: anyArgs()}},
+			Decision: Decision{Type: Log},
+		},
+	}
+	cases := []TestCasesDecompile{
+		{explainedFilter(), false},
+		{multiArch, false},
+		{x32Rules, false},
+		{argumentsFilter("amd64"), true},
+		{argumentsFilter("arm"), true},
+		{treeFilter(), false},
+		{Filter{Architecture: "arm64", DefaultDecision: Decision{Type: Allow}}, true},
+	}
+	for i, tc := range cases {
+		program, err := tc.filter.Compile()
+		if err != nil {
+			t.Fatalf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+		}
+		decompiled, err := Decompile(program, tc.filter.Architecture)
+		if err != nil {
+			t.Errorf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+			continue
+		}
+		difference, err := tc.filter.Equivalent(decompiled)
+		if err != nil || difference != nil {
+			t.Errorf("[%d/%d] Expected equivalent filters, got %+v (%v)", i+1, len(cases), difference, err)
+		}
+		if len(tc.filter.SecondaryArchitectures) != 0 &&
+			!reflect.DeepEqual(decompiled.SecondaryArchitectures, tc.filter.SecondaryArchitectures) {
+			t.Errorf(
+				"[%d/%d] Expected secondary architectures %v got %v",
+				i+1, len(cases),
+				tc.filter.SecondaryArchitectures,
+				decompiled.SecondaryArchitectures,
+			)
+		}
+		if len(decompiled.ArchElements) != len(tc.filter.ArchElements) {
+			t.Errorf("[%d/%d] Expected ArchElements for %d architectures got %v", i+1, len(cases), len(tc.filter.ArchElements), decompiled.ArchElements)
+		}
+		if decompiled.X32Policy != tc.filter.X32Policy {
+			t.Errorf("[%d/%d] Expected x32 policy %d got %d", i+1, len(cases), tc.filter.X32Policy, decompiled.X32Policy)
+		}
+		if tc.same && !reflect.DeepEqual(decompiled.Elements, tc.filter.Elements) {
+			t.Errorf("[%d/%d] Expected '%+v' got '%+v'", i+1, len(cases), tc.filter.Elements, decompiled.Elements)
+		}
+	}
+}
+
+func TestDecompileLinear(t *testing.T) {
+	// Elements are only compiled one after the other when it is cheaper than a
+	// tree, which is never the case with arguments checks
+	filter := Filter{
+		Architecture: "amd64",
+		Elements: []FilterElement{
+			{
+				Match: []SyscallCallFilter{
+					{Number: unix.SYS_WRITE, Args: anyArgs()},
+					{Number: unix.SYS_READ, Args: [6]SyscallArgument{Equal(3), Any(), Any(), Any(), Any(), Any()}},
+				},
+				Decision: Decision{Type: Allow},
+			},
+			{
+				Match:    []SyscallCallFilter{{Number: unix.SYS_CLOSE, Args: anyArgs()}},
+				Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+			},
+		},
+		DefaultDecision: Decision{Type: KillThread},
+	}
+	kill := filter.badArchDecision().compile()
+	program := []bpf.Instruction{
+		lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: lowlevel.GetAuditArch("amd64"), SkipTrue: 1},
+		kill,
+		lowlevel.LoadSeccompDataField("Number", false, "amd64"),
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: skippedSyscall, SkipTrue: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: lowlevel.X32_SYSCALL_BIT, SkipFalse: 1},
+		kill,
+	}
+	for _, element := range filter.Elements {
+		program = append(program, element.compile("amd64")...)
+	}
+	program = append(program, filter.DefaultDecision.compile())
+	decompiled, err := Decompile(assembleNoError(program), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decompiled.Elements, filter.Elements) || decompiled.DefaultDecision != filter.DefaultDecision {
+		t.Errorf("Expected '%+v' got '%+v'", filter, *decompiled)
+	}
+}
+
+type TestCasesDecompileErrors struct {
+	program []bpf.RawInstruction
+	arch    string
+	err     string
+}
+
+func TestDecompileErrors(t *testing.T) {
+	source := explainedFilter()
+	compiled, err := source.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigEndian := explainedFilter()
+	bigEndian.Architecture = "s390x"
+	s390x, err := bigEndian.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	retA := assembleNoError([]bpf.Instruction{bpf.RetA{}})
+	cases := []TestCasesDecompileErrors{
+		{compiled, "foo", "unknown architecture"},
+		{nil, "amd64", "empty program"},
+		{retA, "amd64", "expected the architecture load"},
+		{s390x, "amd64", "endianness differs"},
+		{
+			assembleNoError([]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: 1, SkipTrue: 1},
+				bpf.RetConstant{Val: 0},
+				bpf.RetConstant{Val: 0},
+			}),
+			"amd64", "expected an architecture check",
+		},
+		{compiled[:len(compiled)-1], "amd64", "out of the program"},
+		{append(append([]bpf.RawInstruction{}, compiled[:len(compiled)-1]...), retA...), "amd64", "program not compiled by goseccomp"},
+	}
+	for i, tc := range cases {
+		_, err := Decompile(tc.program, tc.arch)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf(
+				"[%d/%d] Expected error containing '%s' got '%v'",
+				i+1, len(cases),
+				tc.err,
+				err,
+			)
+		}
+	}
+
+}
@@ -0,0 +1,180 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// AnnotatedInstruction is an instruction of a disassembled seccomp program
+type AnnotatedInstruction struct {
+	// Instruction is the decoded instruction
+	Instruction bpf.Instruction
+	// Comment tells the loaded seccomp data field, the compared syscall or
+	// architecture, the jump targets or the returned decision
+	Comment string
+}
+
+// Listing is a disassembled seccomp program
+type Listing []AnnotatedInstruction
+
+// String formats the listing, one numbered instruction per line
+func (l Listing) String() string {
+	var builder strings.Builder
+	for i, instruction := range l {
+		line := fmt.Sprintf("%04d: %v", i, instruction.Instruction)
+		if instruction.Comment != "" {
+			line = fmt.Sprintf("%-40s ; %s", line, instruction.Comment)
+		}
+		builder.WriteString(line)
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
+
+// disassemblyState is what is known of the program state before an instruction
+type disassemblyState struct {
+	reachable bool
+	// field is the seccomp data field in A, empty if unknown
+	field    string
+	highByte bool
+	// table is the syscall table of the architecture being filtered, empty if unknown
+	table string
+}
+
+func (s disassemblyState) merge(other disassemblyState) disassemblyState {
+	if !s.reachable {
+		return other
+	}
+	if s.field != other.field || s.highByte != other.highByte {
+		s.field = ""
+	}
+	if s.table != other.table {
+		s.table = ""
+	}
+	return s
+}
+
+// jumpComment annotates a conditional jump and returns the states at its targets
+func (s disassemblyState) jumpComment(cond bpf.JumpTest, val uint32, targets [2]int) (string, [2]disassemblyState) {
+	comment := fmt.Sprintf("true: %04d, false: %04d", targets[0], targets[1])
+	next := [2]disassemblyState{s, s}
+	switch s.field {
+	case "Number":
+		switch {
+		case (cond == bpf.JumpEqual || cond == bpf.JumpNotEqual) && val == skippedSyscall:
+			comment += ", skipped syscall"
+		case cond != bpf.JumpBitsSet && cond != bpf.JumpBitsNotSet:
+			if name, ok := lowlevel.SyscallName(s.table, uint(val)); ok {
+				comment += fmt.Sprintf(", syscall %s", name)
+			}
+		case val == lowlevel.X32_SYSCALL_BIT && s.table == "amd64":
+			comment += ", x32 syscall bit"
+			if cond == bpf.JumpBitsSet {
+				next[0].table = "x32"
+			} else {
+				next[1].table = "x32"
+			}
+		}
+	case "Arch":
+		arch, ok := lowlevel.GoArch(val)
+		if !ok || (cond != bpf.JumpEqual && cond != bpf.JumpNotEqual) {
+			break
+		}
+		comment += fmt.Sprintf(", arch %s", arch)
+		if cond == bpf.JumpEqual {
+			next[0].table = arch
+		} else {
+			next[1].table = arch
+		}
+	}
+	return comment, next
+}
+
+// Disassemble decodes a compiled seccomp program running on the given architecture
+// into an annotated listing. Comparisons are annotated with syscall names using the
+// syscall table of the architecture checked before them, or arch if none is.
+func Disassemble(program []bpf.RawInstruction, arch string) (Listing, error) {
+	if lowlevel.GetAuditArch(arch) == 0 {
+		return nil, fmt.Errorf("unknown architecture '%s'", arch)
+	}
+	instructions, allDecoded := bpf.Disassemble(program)
+	if !allDecoded {
+		return nil, fmt.Errorf("program contains unknown instructions")
+	}
+	listing := make(Listing, len(instructions))
+	states := make([]disassemblyState, len(instructions)+1)
+	if len(instructions) != 0 {
+		states[0] = disassemblyState{reachable: true, table: arch}
+	}
+	for pc, instruction := range instructions {
+		listing[pc].Instruction = instruction
+		state := states[pc]
+		if !state.reachable {
+			listing[pc].Comment = "unreachable"
+			continue
+		}
+		targets := []int{pc + 1}
+		next := []disassemblyState{state}
+		switch instruction := instruction.(type) {
+		case bpf.LoadAbsolute:
+			field, highByte, ok := lowlevel.SeccompDataField(instruction.Off, arch)
+			if !ok || instruction.Size != 4 {
+				return nil, fmt.Errorf("instruction %d: invalid seccomp data load %+v", pc, instruction)
+			}
+			listing[pc].Comment = field
+			if highByte {
+				listing[pc].Comment += " (high 32 bits)"
+			}
+			next[0].field, next[0].highByte = field, highByte
+		case bpf.Jump:
+			targets[0] = pc + 1 + int(instruction.Skip)
+			listing[pc].Comment = fmt.Sprintf("%04d", targets[0])
+		case bpf.JumpIf:
+			if instruction.Cond == bpf.JumpBitsNotSet {
+				// Shown as the jset it is assembled to
+				instruction = bpf.JumpIf{
+					Cond:      bpf.JumpBitsSet,
+					Val:       instruction.Val,
+					SkipTrue:  instruction.SkipFalse,
+					SkipFalse: instruction.SkipTrue,
+				}
+				listing[pc].Instruction = instruction
+			}
+			jumpTargets := [2]int{pc + 1 + int(instruction.SkipTrue), pc + 1 + int(instruction.SkipFalse)}
+			comment, jumpStates := state.jumpComment(instruction.Cond, instruction.Val, jumpTargets)
+			listing[pc].Comment = comment
+			targets, next = jumpTargets[:], jumpStates[:]
+		case bpf.JumpIfX:
+			targets = []int{pc + 1 + int(instruction.SkipTrue), pc + 1 + int(instruction.SkipFalse)}
+			next = []disassemblyState{state, state}
+			listing[pc].Comment = fmt.Sprintf("true: %04d, false: %04d", targets[0], targets[1])
+		case bpf.RetConstant:
+			listing[pc].Comment = pfcAction(returnedDecision(instruction.Val))
+			targets = nil
+		case bpf.RetA:
+			targets = nil
+		case bpf.LoadConstant:
+			if instruction.Dst == bpf.RegA {
+				next[0].field = ""
+			}
+		case bpf.LoadScratch:
+			if instruction.Dst == bpf.RegA {
+				next[0].field = ""
+			}
+		case bpf.LoadExtension, bpf.ALUOpConstant, bpf.ALUOpX, bpf.NegateA, bpf.TXA:
+			next[0].field = ""
+		}
+		for i, target := range targets {
+			if target > len(instructions) {
+				return nil, fmt.Errorf("instruction %d: jump out of the program", pc)
+			}
+			states[target] = states[target].merge(next[i])
+		}
+	}
+	return listing, nil
+}
@@ -0,0 +1,101 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestDisassemble(t *testing.T) {
+	listing, err := Disassemble(simulatedFilter(t, "amd64"), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `0000: ld [4]                             ; Arch
+0001: jeq #3221225534,1                  ; true: 0003, false: 0002, arch amd64
+0002: ret #196608                        ; TRAP
+0003: ld [0]                             ; Number
+0004: jeq #4294967295,2                  ; true: 0007, false: 0005, skipped syscall
+0005: jset #1073741824,0,1               ; true: 0006, false: 0007, x32 syscall bit
+0006: ret #196608                        ; TRAP
+0007: jgt #0,3                           ; true: 0011, false: 0008, syscall read
+0008: jneq #0,1                          ; true: 0010, false: 0009, syscall read
+0009: ret #2147418112                    ; ALLOW
+0010: ret #327718                        ; ERRNO(38)
+0011: jneq #121,6                        ; true: 0018, false: 0012, syscall getpgid
+0012: ld [20]                            ; Arg0 (high 32 bits)
+0013: jgt #0,3                           ; true: 0017, false: 0014
+0014: jneq #0,3                          ; true: 0018, false: 0015
+0015: ld [16]                            ; Arg0
+0016: jle #16,1                          ; true: 0018, false: 0017
+0017: ret #327681                        ; ERRNO(1)
+0018: ret #327718                        ; ERRNO(38)
+`
+	if listing.String() != expected {
+		t.Errorf("\n\tExpected:\n%s\n\tGot:\n%s", expected, listing)
+	}
+}
+
+func TestDisassembleSecondaryArchitecture(t *testing.T) {
+	listing, err := Disassemble(simulatedFilter(t, "arm64", "arm"), "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// getpgid is 155 on arm64 and 132 on arm
+	found := map[string]bool{}
+	for _, instruction := range listing {
+		if jump, ok := instruction.Instruction.(bpf.JumpIf); ok && jump.Cond == bpf.JumpNotEqual {
+			switch jump.Val {
+			case 155, 132:
+				found[instruction.Comment] = true
+			}
+		}
+	}
+	for _, comment := range []string{
+		"true: 0018, false: 0012, syscall getpgid",
+		"true: 0028, false: 0025, syscall getpgid",
+	} {
+		if !found[comment] {
+			t.Errorf("Expected an instruction annotated '%s' in:\n%s", comment, listing)
+		}
+	}
+}
+
+func TestDisassembleUnknownAction(t *testing.T) {
+	program, err := bpf.Assemble([]bpf.Instruction{bpf.RetConstant{Val: 0x00010005}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing, err := Disassemble(program, "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "0000: ret #65541                         ; 0x00010005\n"
+	if listing.String() != expected {
+		t.Errorf("\n\tExpected:\n%s\n\tGot:\n%s", expected, listing)
+	}
+}
+
+type TestCasesDisassembleErrors struct {
+	program []bpf.Instruction
+	arch    string
+}
+
+func TestDisassembleErrors(t *testing.T) {
+	cases := []TestCasesDisassembleErrors{
+		{[]bpf.Instruction{bpf.RetA{}}, "vax"},
+		{[]bpf.Instruction{bpf.LoadAbsolute{Off: 2, Size: 4}, bpf.RetA{}}, "amd64"},
+		{[]bpf.Instruction{bpf.Jump{Skip: 2}, bpf.RetA{}}, "amd64"},
+	}
+	for i, tc := range cases {
+		program, err := bpf.Assemble(tc.program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if listing, err := Disassemble(program, tc.arch); err == nil {
+			t.Errorf("[%d/%d] Expected an error, got:\n%s", i+1, len(cases), listing)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// DockerSeccomp is a Docker (Moby) seccomp profile, an OCI one extended with
+// conditional rules and a per architecture list of sub-architectures.
+type DockerSeccomp struct {
+	DefaultAction    string          `json:"defaultAction"`
+	DefaultErrnoRet  *uint           `json:"defaultErrnoRet,omitempty"`
+	Architectures    []string        `json:"architectures,omitempty"`
+	ArchMap          []DockerArchMap `json:"archMap,omitempty"`
+	Flags            []string        `json:"flags,omitempty"`
+	ListenerPath     string          `json:"listenerPath,omitempty"`
+	ListenerMetadata string          `json:"listenerMetadata,omitempty"`
+	Syscalls         []DockerSyscall `json:"syscalls"`
+}
+
+// DockerArchMap gives the sub-architectures filtered along a native architecture
+type DockerArchMap struct {
+	Architecture     string   `json:"architecture"`
+	SubArchitectures []string `json:"subArchitectures"`
+}
+
+// DockerSyscall is a rule of a Docker seccomp profile
+type DockerSyscall struct {
+	Name     string           `json:"name,omitempty"`
+	Names    []string         `json:"names,omitempty"`
+	Action   string           `json:"action"`
+	ErrnoRet *uint            `json:"errnoRet,omitempty"`
+	Args     []OCISeccompArg  `json:"args,omitempty"`
+	Comment  string           `json:"comment,omitempty"`
+	Includes *DockerCondition `json:"includes,omitempty"`
+	Excludes *DockerCondition `json:"excludes,omitempty"`
+}
+
+// DockerCondition tells when a rule of a Docker seccomp profile applies
+type DockerCondition struct {
+	// Caps are capabilities names such as "CAP_SYS_ADMIN"
+	Caps []string `json:"caps,omitempty"`
+	// Arches are Go architecture names, "x32" included
+	Arches []string `json:"arches,omitempty"`
+	// MinKernel is a "major.minor" kernel version
+	MinKernel string `json:"minKernel,omitempty"`
+}
+
+// DockerEnvironment is what the conditions of a Docker seccomp profile are evaluated against
+type DockerEnvironment struct {
+	// Arch is the native Go architecture
+	Arch string
+	// Capabilities is the bounding set of the container, such as "CAP_SYS_ADMIN"
+	Capabilities []string
+	// KernelVersion is the running kernel version, as given by uname (e.g. "6.1.0-18-amd64"),
+	// it is only needed if the profile has minKernel conditions.
+	KernelVersion string
+}
+
+// kernelVersion parses the major and minor parts of a kernel version
+func kernelVersion(version string) ([2]uint, error) {
+	var parsed [2]uint
+	if _, err := fmt.Sscanf(version, "%d.%d", &parsed[0], &parsed[1]); err != nil {
+		return parsed, fmt.Errorf("invalid kernel version '%s'", version)
+	}
+	return parsed, nil
+}
+
+// kernelAtLeast tells if the environment kernel is at least the given version
+func (e *DockerEnvironment) kernelAtLeast(version string) (bool, error) {
+	minimum, err := kernelVersion(version)
+	if err != nil {
+		return false, err
+	}
+	if e.KernelVersion == "" {
+		return false, fmt.Errorf("minKernel '%s' needs a kernel version", version)
+	}
+	current, err := kernelVersion(e.KernelVersion)
+	if err != nil {
+		return false, err
+	}
+	return current[0] > minimum[0] || (current[0] == minimum[0] && current[1] >= minimum[1]), nil
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applies tells if the rule applies in the environment, as Docker does:
+// an excluded architecture, capability or kernel version discards the rule,
+// as does any missing included one.
+func (s *DockerSyscall) applies(env *DockerEnvironment) (bool, error) {
+	if s.Excludes != nil {
+		if contains(s.Excludes.Arches, env.Arch) {
+			return false, nil
+		}
+		for _, capability := range s.Excludes.Caps {
+			if contains(env.Capabilities, capability) {
+				return false, nil
+			}
+		}
+		if s.Excludes.MinKernel != "" {
+			newer, err := env.kernelAtLeast(s.Excludes.MinKernel)
+			if err != nil || newer {
+				return false, err
+			}
+		}
+	}
+	if s.Includes != nil {
+		if len(s.Includes.Arches) != 0 && !contains(s.Includes.Arches, env.Arch) {
+			return false, nil
+		}
+		for _, capability := range s.Includes.Caps {
+			if !contains(env.Capabilities, capability) {
+				return false, nil
+			}
+		}
+		if s.Includes.MinKernel != "" {
+			newer, err := env.kernelAtLeast(s.Includes.MinKernel)
+			if err != nil || !newer {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// ParseDockerSeccomp parses a Docker seccomp profile into a Filter for the
+// given environment, see [DockerSeccomp.OCISeccomp].
+func ParseDockerSeccomp(data []byte, env DockerEnvironment) (*Filter, error) {
+	var profile DockerSeccomp
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return nil, err
+	}
+	oci, err := profile.OCISeccomp(env)
+	if err != nil {
+		return nil, err
+	}
+	return oci.Filter(env.Arch)
+}
+
+// OCISeccomp evaluates the conditions of the profile in the given environment
+// and returns the resulting OCI profile, the way Docker does it.
+func (p *DockerSeccomp) OCISeccomp(env DockerEnvironment) (*OCISeccomp, error) {
+	if len(p.Architectures) != 0 && len(p.ArchMap) != 0 {
+		return nil, fmt.Errorf("both architectures and archMap are given")
+	}
+	profile := &OCISeccomp{
+		DefaultAction:    p.DefaultAction,
+		DefaultErrnoRet:  p.DefaultErrnoRet,
+		Architectures:    p.Architectures,
+		Flags:            p.Flags,
+		ListenerPath:     p.ListenerPath,
+		ListenerMetadata: p.ListenerMetadata,
+	}
+	if len(p.ArchMap) != 0 {
+		native, err := ociArchitecture(env.Arch)
+		if err != nil {
+			return nil, err
+		}
+		for _, archMap := range p.ArchMap {
+			if archMap.Architecture == native {
+				profile.Architectures = append(profile.Architectures, archMap.Architecture)
+				profile.Architectures = append(profile.Architectures, archMap.SubArchitectures...)
+			}
+		}
+	}
+	for i, syscall := range p.Syscalls {
+		names := syscall.Names
+		if syscall.Name != "" {
+			if len(names) != 0 {
+				return nil, fmt.Errorf("syscalls[%d]: both name and names are given", i)
+			}
+			names = []string{syscall.Name}
+		}
+		applies, err := syscall.applies(&env)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		if !applies {
+			continue
+		}
+		profile.Syscalls = append(profile.Syscalls, OCISyscall{
+			Names:    names,
+			Action:   syscall.Action,
+			ErrnoRet: syscall.ErrnoRet,
+			Args:     syscall.Args,
+		})
+	}
+	return profile, nil
+}
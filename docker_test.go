@@ -0,0 +1,223 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+const dockerProfile = `{
+	"defaultAction": "SCMP_ACT_ERRNO",
+	"defaultErrnoRet": 1,
+	"archMap": [
+		{
+			"architecture": "SCMP_ARCH_X86_64",
+			"subArchitectures": ["SCMP_ARCH_X86", "SCMP_ARCH_X32"]
+		},
+		{
+			"architecture": "SCMP_ARCH_AARCH64",
+			"subArchitectures": ["SCMP_ARCH_ARM"]
+		}
+	],
+	"syscalls": [
+		{
+			"names": ["read", "write"],
+			"action": "SCMP_ACT_ALLOW"
+		},
+		{
+			"name": "arch_prctl",
+			"action": "SCMP_ACT_ALLOW",
+			"includes": {"arches": ["amd64", "x32"]}
+		},
+		{
+			"names": ["clone"],
+			"action": "SCMP_ACT_ALLOW",
+			"args": [{"index": 0, "value": 2114060288, "valueTwo": 0, "op": "SCMP_CMP_MASKED_EQ"}],
+			"excludes": {"caps": ["CAP_SYS_ADMIN"], "arches": ["s390", "s390x"]},
+			"comment": "s390 parameter ordering for clone is different"
+		},
+		{
+			"names": ["clone"],
+			"action": "SCMP_ACT_ALLOW",
+			"includes": {"caps": ["CAP_SYS_ADMIN"]}
+		},
+		{
+			"names": ["clone3"],
+			"action": "SCMP_ACT_ERRNO",
+			"errnoRet": 38,
+			"excludes": {"caps": ["CAP_SYS_ADMIN"]}
+		},
+		{
+			"names": ["pidfd_getfd"],
+			"action": "SCMP_ACT_ALLOW",
+			"includes": {"minKernel": "5.6"}
+		}
+	]
+}`
+
+type TestCasesParseDockerSeccomp struct {
+	env      DockerEnvironment
+	syscall  string
+	arg0     uint64
+	expected Decision
+}
+
+func TestParseDockerSeccomp(t *testing.T) {
+	allow := Decision{Type: Allow}
+	eperm := Decision{Type: Errno, Data: uint16(unix.EPERM)}
+	enosys := Decision{Type: Errno, Data: uint16(unix.ENOSYS)}
+	user := DockerEnvironment{Arch: "amd64", KernelVersion: "5.4.0-42-generic"}
+	admin := DockerEnvironment{Arch: "amd64", Capabilities: []string{"CAP_SYS_ADMIN"}, KernelVersion: "6.1"}
+	cases := []TestCasesParseDockerSeccomp{
+		{user, "read", 0, allow},
+		{user, "arch_prctl", 0, allow},
+		{user, "clone", 0, allow},
+		{user, "clone", unix.CLONE_NEWNS, eperm},
+		{user, "clone3", 0, enosys},
+		{user, "pidfd_getfd", 0, eperm},
+		{admin, "clone", unix.CLONE_NEWNS, allow},
+		{admin, "clone3", 0, eperm},
+		{admin, "pidfd_getfd", 0, allow},
+	}
+	for i, tc := range cases {
+		filter, err := ParseDockerSeccomp([]byte(dockerProfile), tc.env)
+		if err != nil {
+			t.Fatalf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+		}
+		number, ok := lowlevel.SyscallNumber("amd64", tc.syscall)
+		if !ok {
+			t.Fatalf("[%d/%d] no %s syscall on amd64", i+1, len(cases), tc.syscall)
+		}
+		data := lowlevel.SeccompData{Number: int32(number), Arch: lowlevel.GetAuditArch("amd64"), Arg0: tc.arg0}
+		got, err := filter.Explain(data)
+		if err != nil || got.Decision != tc.expected {
+			t.Errorf(
+				"[%d/%d] %s(0x%x): Expected '%+v' got '%+v' (%v)",
+				i+1, len(cases),
+				tc.syscall, tc.arg0,
+				tc.expected,
+				got.Decision,
+				err,
+			)
+		}
+	}
+}
+
+func TestDockerSeccompArchitectures(t *testing.T) {
+	env := DockerEnvironment{Arch: "arm64", KernelVersion: "6.1"}
+	filter, err := ParseDockerSeccomp([]byte(dockerProfile), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter.SecondaryArchitectures, []string{"arm"}) || filter.X32Policy != X32Deny {
+		t.Errorf("Unexpected architectures %v (x32 policy %d)", filter.SecondaryArchitectures, filter.X32Policy)
+	}
+	for _, element := range filter.Elements {
+		for _, match := range element.Match {
+			if name, _ := match.Name("arm64"); name == "arch_prctl" {
+				t.Errorf("arch_prctl is only for amd64")
+			}
+		}
+	}
+
+	filter, err = ParseDockerSeccomp([]byte(dockerProfile), DockerEnvironment{Arch: "amd64", KernelVersion: "6.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(filter.SecondaryArchitectures, []string{"386"}) || filter.X32Policy != X32Rules {
+		t.Errorf("Unexpected architectures %v (x32 policy %d)", filter.SecondaryArchitectures, filter.X32Policy)
+	}
+}
+
+type TestCasesParseDockerDefault struct {
+	arch     string
+	syscall  string
+	expected Decision
+}
+
+func TestParseDockerDefault(t *testing.T) {
+	profile, err := os.ReadFile("testdata/docker-default.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ParseDockerSeccomp(profile, DockerEnvironment{Arch: "amd64", KernelVersion: "6.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := filter.Compile()
+	if err != nil {
+		t.Skipf("Failed to compile, skipping")
+	}
+	// socketcall, mmap2 and _llseek only exist on 386
+	cases := []TestCasesParseDockerDefault{
+		{"amd64", "read", Decision{Type: Allow}},
+		{"amd64", "arch_prctl", Decision{Type: Allow}},
+		{"amd64", "mount", filter.DefaultDecision},
+		{"386", "read", Decision{Type: Allow}},
+		{"386", "socketcall", Decision{Type: Allow}},
+		{"386", "mmap2", Decision{Type: Allow}},
+		{"386", "_llseek", Decision{Type: Allow}},
+		{"386", "mount", filter.DefaultDecision},
+	}
+	for i, tc := range cases {
+		number, ok := lowlevel.SyscallNumber(tc.arch, tc.syscall)
+		if !ok {
+			t.Fatalf("no %s syscall on %s", tc.syscall, tc.arch)
+		}
+		data := lowlevel.SeccompData{Number: int32(number), Arch: lowlevel.GetAuditArch(tc.arch)}
+		got, err := Evaluate(program, data, "amd64")
+		if err != nil || got != tc.expected {
+			t.Errorf(
+				"[%d/%d] %s on %s: Expected '%+v' got '%+v' (%v)",
+				i+1, len(cases),
+				tc.syscall, tc.arch,
+				tc.expected,
+				got,
+				err,
+			)
+		}
+	}
+}
+
+type TestCasesParseDockerSeccompErrors struct {
+	profile string
+	env     DockerEnvironment
+	err     string
+}
+
+func TestParseDockerSeccompErrors(t *testing.T) {
+	amd64 := DockerEnvironment{Arch: "amd64"}
+	cases := []TestCasesParseDockerSeccompErrors{
+		{dockerProfile, amd64, "syscalls[5]: minKernel '5.6' needs a kernel version"},
+		{dockerProfile, DockerEnvironment{Arch: "amd64", KernelVersion: "latest"}, "invalid kernel version 'latest'"},
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_X86_64"], "archMap": [{"architecture": "SCMP_ARCH_X86_64"}], "syscalls": []}`,
+			amd64, "both architectures and archMap",
+		},
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"name": "read", "names": ["write"], "action": "SCMP_ACT_KILL"}]}`,
+			amd64, "syscalls[0]: both name and names",
+		},
+		{
+			`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_KILL", "includes": {"kernel": "5.6"}}]}`,
+			amd64, "unknown field",
+		},
+	}
+	for i, tc := range cases {
+		_, err := ParseDockerSeccomp([]byte(tc.profile), tc.env)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf(
+				"[%d/%d] Expected error containing '%s' got '%v'",
+				i+1, len(cases),
+				tc.err,
+				err,
+			)
+		}
+	}
+}
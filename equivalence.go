@@ -0,0 +1,410 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// maxEquivalenceSteps bounds the number of instructions explored by an equivalence check
+const maxEquivalenceSteps = 1 << 22
+
+// maxSolverSteps bounds the search of a value meeting the inequalities on a seccomp
+// data word, the bits of the inequalities being fixed one by one. Filters only
+// reach it with many inequalities on different masks excluding all the values.
+const maxSolverSteps = 1 << 20
+
+var errTooComplex = errors.New("programs too complex to be checked for equivalence")
+
+var errDifferenceFound = errors.New("difference found")
+
+// Difference is a seccomp data on which two programs take different decisions
+type Difference struct {
+	Data   lowlevel.SeccompData
+	First  Decision
+	Second Decision
+}
+
+// maskedValue is the condition word & mask == value
+type maskedValue struct {
+	mask  uint32
+	value uint32
+}
+
+// wordConstraints are the conditions met by a seccomp data word along a program path
+type wordConstraints struct {
+	low, high uint32
+	equal     maskedValue
+	// excluded holds the sorted values the word can't take
+	excluded []uint32
+	notEqual []maskedValue
+}
+
+// symbolicValue is the content of a register, either a constant or
+// a seccomp data word masked by a constant.
+type symbolicValue struct {
+	word  int
+	mask  uint32
+	value uint32
+}
+
+type symbolicState struct {
+	a, x  symbolicValue
+	words [16]wordConstraints
+}
+
+func constantValue(value uint32) symbolicValue {
+	return symbolicValue{word: -1, value: value}
+}
+
+func initialState() symbolicState {
+	state := symbolicState{a: constantValue(0), x: constantValue(0)}
+	for i := range state.words {
+		state.words[i].high = ^uint32(0)
+	}
+	return state
+}
+
+// withEqual adds the condition word & mask == value.
+func (w wordConstraints) withEqual(mask, value uint32) (wordConstraints, bool) {
+	if value&^mask != 0 || (w.equal.mask&mask)&(w.equal.value^value) != 0 {
+		return w, false
+	}
+	w.equal.mask |= mask
+	w.equal.value |= value
+	return w, true
+}
+
+// withNotEqual adds the condition word & mask != value.
+func (w wordConstraints) withNotEqual(mask, value uint32) (wordConstraints, bool) {
+	if value&^mask != 0 {
+		return w, true
+	}
+	if mask == 0 {
+		return w, false
+	}
+	if mask == ^uint32(0) {
+		i := sort.Search(len(w.excluded), func(i int) bool { return w.excluded[i] >= value })
+		if i == len(w.excluded) || w.excluded[i] != value {
+			excluded := make([]uint32, len(w.excluded)+1)
+			copy(excluded, w.excluded[:i])
+			excluded[i] = value
+			copy(excluded[i+1:], w.excluded[i:])
+			w.excluded = excluded
+		}
+		return w, true
+	}
+	for _, c := range w.notEqual {
+		if c.mask == mask && c.value == value {
+			return w, true
+		}
+	}
+	w.notEqual = append(w.notEqual[:len(w.notEqual):len(w.notEqual)], maskedValue{mask, value})
+	return w, true
+}
+
+// with adds the condition (word & mask) cond val is result, and tells if
+// the constraints can still be met.
+func (w wordConstraints) with(mask uint32, cond bpf.JumpTest, val uint32, result bool) (wordConstraints, bool, error) {
+	switch cond {
+	case bpf.JumpNotEqual:
+		cond, result = bpf.JumpEqual, !result
+	case bpf.JumpLessThan:
+		cond, result = bpf.JumpGreaterOrEqual, !result
+	case bpf.JumpLessOrEqual:
+		cond, result = bpf.JumpGreaterThan, !result
+	case bpf.JumpBitsNotSet:
+		cond, result = bpf.JumpBitsSet, !result
+	}
+	feasible := true
+	switch {
+	case cond == bpf.JumpEqual && result:
+		w, feasible = w.withEqual(mask, val)
+	case cond == bpf.JumpEqual:
+		w, feasible = w.withNotEqual(mask, val)
+	case cond == bpf.JumpBitsSet && result:
+		w, feasible = w.withNotEqual(mask&val, 0)
+	case cond == bpf.JumpBitsSet:
+		w, feasible = w.withEqual(mask&val, 0)
+	case mask != ^uint32(0):
+		return w, false, fmt.Errorf("ordered comparison of a masked word is not supported")
+	case cond == bpf.JumpGreaterThan && result:
+		feasible = val != ^uint32(0)
+		if feasible && val+1 > w.low {
+			w.low = val + 1
+		}
+	case cond == bpf.JumpGreaterThan:
+		if val < w.high {
+			w.high = val
+		}
+	case result:
+		if val > w.low {
+			w.low = val
+		}
+	default:
+		feasible = val != 0
+		if feasible && val-1 < w.high {
+			w.high = val - 1
+		}
+	}
+	if !feasible {
+		return w, false, nil
+	}
+	_, feasible, err := w.witness()
+	return w, feasible, err
+}
+
+// witness returns the smallest value meeting the constraints, if any.
+func (w wordConstraints) witness() (uint32, bool, error) {
+	if w.low > w.high {
+		return 0, false, nil
+	}
+	inequalities := make([]maskedValue, 0, len(w.excluded)+len(w.notEqual))
+	for _, value := range w.excluded {
+		inequalities = append(inequalities, maskedValue{^uint32(0), value})
+	}
+	inequalities = append(inequalities, w.notEqual...)
+	steps := 0
+	// The values between low and high are a sequence of aligned blocks, each
+	// of them having fixed high bits.
+	for low := uint64(w.low); low <= uint64(w.high); {
+		size := uint64(1)
+		for low&(2*size-1) == 0 && low+2*size-1 <= uint64(w.high) {
+			size *= 2
+		}
+		block := maskedValue{mask: ^uint32(size - 1), value: uint32(low)}
+		low += size
+		if block.mask&w.equal.mask&(block.value^w.equal.value) != 0 {
+			continue
+		}
+		fixed := maskedValue{block.mask | w.equal.mask, block.value | w.equal.value}
+		value, ok, err := solveInequalities(fixed, inequalities, &steps)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return 0, false, nil
+}
+
+// solveInequalities returns the smallest value having the fixed bits that meets
+// the inequalities word & mask != value, if any. Only the bits of the inequalities
+// are searched, the others are left to 0.
+func solveInequalities(fixed maskedValue, inequalities []maskedValue, steps *int) (uint32, bool, error) {
+	*steps++
+	if *steps > maxSolverSteps {
+		return 0, false, errTooComplex
+	}
+	var pending []maskedValue
+	var free uint32
+	for _, c := range inequalities {
+		if c.mask&fixed.mask&(c.value^fixed.value) != 0 {
+			// A fixed bit already differs
+			continue
+		}
+		unfixed := c.mask &^ fixed.mask
+		if unfixed == 0 {
+			return 0, false, nil
+		}
+		pending = append(pending, c)
+		free |= unfixed
+	}
+	if len(pending) == 0 {
+		return fixed.value, true, nil
+	}
+	// Fix the highest free bit, to 0 first for the smallest value
+	bit := uint32(1) << (31 - bits.LeadingZeros32(free))
+	for _, value := range []uint32{0, bit} {
+		next := maskedValue{fixed.mask | bit, fixed.value | value}
+		value, ok, err := solveInequalities(next, pending, steps)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return 0, false, nil
+}
+
+type equivalenceChecker struct {
+	steps int
+}
+
+// run explores the paths of the program from pc, calling onReturn with the
+// constraints of each path and its return value.
+func (c *equivalenceChecker) run(program []bpf.Instruction, pc int, state symbolicState, onReturn func(symbolicState, uint32) error) error {
+	for ; pc < len(program); pc++ {
+		c.steps++
+		if c.steps > maxEquivalenceSteps {
+			return errTooComplex
+		}
+		switch instruction := program[pc].(type) {
+		case bpf.LoadAbsolute:
+			if instruction.Size != 4 || instruction.Off%4 != 0 || instruction.Off >= 4*uint32(len(state.words)) {
+				return fmt.Errorf("instruction %d: invalid seccomp data load %+v", pc, instruction)
+			}
+			state.a = symbolicValue{word: int(instruction.Off / 4), mask: ^uint32(0)}
+		case bpf.LoadConstant:
+			if instruction.Dst == bpf.RegA {
+				state.a = constantValue(instruction.Val)
+			} else {
+				state.x = constantValue(instruction.Val)
+			}
+		case bpf.ALUOpConstant:
+			switch {
+			case (instruction.Op == bpf.ALUOpDiv || instruction.Op == bpf.ALUOpMod) && instruction.Val == 0:
+				return fmt.Errorf("instruction %d: division by zero", pc)
+			case state.a.word < 0:
+				state.a.value = aluOp(instruction.Op, state.a.value, instruction.Val)
+			case instruction.Op == bpf.ALUOpAnd:
+				state.a.mask &= instruction.Val
+				if state.a.mask == 0 {
+					state.a = constantValue(0)
+				}
+			default:
+				return fmt.Errorf("instruction %d: %v on seccomp data is not supported", pc, instruction)
+			}
+		case bpf.TAX:
+			state.x = state.a
+		case bpf.TXA:
+			state.a = state.x
+		case bpf.Jump:
+			pc += int(instruction.Skip)
+		case bpf.JumpIf, bpf.JumpIfX:
+			var cond bpf.JumpTest
+			var val uint32
+			var skipTrue, skipFalse uint8
+			if jump, ok := instruction.(bpf.JumpIf); ok {
+				cond, val, skipTrue, skipFalse = jump.Cond, jump.Val, jump.SkipTrue, jump.SkipFalse
+			} else {
+				jump := instruction.(bpf.JumpIfX)
+				if state.x.word >= 0 {
+					return fmt.Errorf("instruction %d: comparison with seccomp data is not supported", pc)
+				}
+				cond, val, skipTrue, skipFalse = jump.Cond, state.x.value, jump.SkipTrue, jump.SkipFalse
+			}
+			if state.a.word < 0 {
+				pc += jumpSkip(cond, state.a.value, val, skipTrue, skipFalse)
+				continue
+			}
+			for _, result := range []bool{true, false} {
+				word, feasible, err := state.words[state.a.word].with(state.a.mask, cond, val, result)
+				if err != nil {
+					return fmt.Errorf("instruction %d: %w", pc, err)
+				}
+				if !feasible {
+					continue
+				}
+				next := state
+				next.words[state.a.word] = word
+				skip := skipFalse
+				if result {
+					skip = skipTrue
+				}
+				if err := c.run(program, pc+1+int(skip), next, onReturn); err != nil {
+					return err
+				}
+			}
+			return nil
+		case bpf.RetA:
+			if state.a.word >= 0 {
+				return fmt.Errorf("instruction %d: returning seccomp data is not supported", pc)
+			}
+			return onReturn(state, state.a.value)
+		case bpf.RetConstant:
+			return onReturn(state, instruction.Val)
+		default:
+			return fmt.Errorf("instruction %d: %T is not supported", pc, instruction)
+		}
+	}
+	return fmt.Errorf("program ends without returning")
+}
+
+// data returns a seccomp data meeting the constraints of the state.
+func (s symbolicState) data(arch string) (lowlevel.SeccompData, error) {
+	var order binary.ByteOrder = binary.BigEndian
+	if lowlevel.ArchIsLittleEndian(arch) {
+		order = binary.LittleEndian
+	}
+	input := make([]byte, 4*len(s.words))
+	for i, word := range s.words {
+		value, _, err := word.witness()
+		if err != nil {
+			return lowlevel.SeccompData{}, err
+		}
+		order.PutUint32(input[4*i:], value)
+	}
+	return lowlevel.SeccompDataFromBytes(input, arch), nil
+}
+
+func equivalent(first, second []bpf.Instruction, arch string) (*Difference, error) {
+	if lowlevel.GetAuditArch(arch) == 0 {
+		return nil, fmt.Errorf("unknown architecture '%s'", arch)
+	}
+	checker := &equivalenceChecker{}
+	var difference *Difference
+	err := checker.run(first, 0, initialState(), func(state symbolicState, firstReturn uint32) error {
+		start := initialState()
+		start.words = state.words
+		return checker.run(second, 0, start, func(state symbolicState, secondReturn uint32) error {
+			firstDecision := decisionFromReturn(firstReturn)
+			secondDecision := decisionFromReturn(secondReturn)
+			if firstDecision == secondDecision {
+				return nil
+			}
+			data, err := state.data(arch)
+			if err != nil {
+				return err
+			}
+			difference = &Difference{Data: data, First: firstDecision, Second: secondDecision}
+			return errDifferenceFound
+		})
+	})
+	if errors.Is(err, errDifferenceFound) {
+		return difference, nil
+	}
+	return nil, err
+}
+
+// EquivalentPrograms checks whether two compiled seccomp programs, running on the given
+// architecture, take the same Decision for every seccomp data. It returns nil if they do,
+// or a Difference holding a seccomp data on which they differ.
+//
+// Only the instructions emitted by [Filter.Compile] are supported: loads of seccomp data
+// words, masking them with a constant and comparing them with constants. An error is
+// returned for other programs, or if the programs are too complex to be checked.
+func EquivalentPrograms(first, second []bpf.RawInstruction, arch string) (*Difference, error) {
+	programs := make([][]bpf.Instruction, 2)
+	for i, program := range [][]bpf.RawInstruction{first, second} {
+		instructions, allDecoded := bpf.Disassemble(program)
+		if !allDecoded {
+			return nil, fmt.Errorf("program contains unknown instructions")
+		}
+		programs[i] = instructions
+	}
+	return equivalent(programs[0], programs[1], arch)
+}
+
+// Equivalent checks whether the Filter and other take the same Decision for every
+// seccomp data once compiled, see [EquivalentPrograms].
+func (f *Filter) Equivalent(other *Filter) (*Difference, error) {
+	if lowlevel.ArchIsLittleEndian(f.Architecture) != lowlevel.ArchIsLittleEndian(other.Architecture) {
+		return nil, fmt.Errorf(
+			"architecture '%s' endianness differs from '%s'",
+			other.Architecture, f.Architecture,
+		)
+	}
+	first, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+	second, err := other.compile()
+	if err != nil {
+		return nil, err
+	}
+	return equivalent(first, second, f.Architecture)
+}
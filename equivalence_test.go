@@ -0,0 +1,274 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+type TestCasesEquivalentPrograms struct {
+	first      []bpf.Instruction
+	second     []bpf.Instruction
+	equivalent bool
+	err        bool
+}
+
+func TestEquivalentPrograms(t *testing.T) {
+	allow := Decision{Type: Allow}.compile()
+	kill := Decision{Type: KillProcess}.compile()
+	number := lowlevel.LoadSeccompDataField("Number", false, "amd64")
+	arg0 := lowlevel.LoadSeccompDataField("Arg0", false, "amd64")
+	cases := []TestCasesEquivalentPrograms{
+		{
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpEqual, Val: 5, SkipFalse: 1}, allow, kill},
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 5, SkipTrue: 1}, allow, kill},
+			true, false,
+		},
+		{
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: 5, SkipFalse: 1}, allow, kill},
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: 6, SkipFalse: 1}, allow, kill},
+			true, false,
+		},
+		{
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: 5, SkipFalse: 1}, allow, kill},
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: 5, SkipFalse: 1}, allow, kill},
+			false, false,
+		},
+		{
+			[]bpf.Instruction{arg0, bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x10, SkipFalse: 1}, allow, kill},
+			[]bpf.Instruction{
+				arg0,
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x30},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x10, SkipFalse: 1},
+				allow, kill,
+			},
+			false, false,
+		},
+		{
+			[]bpf.Instruction{
+				arg0,
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 1},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipTrue: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 1, SkipTrue: 1},
+				allow, kill,
+			},
+			[]bpf.Instruction{kill},
+			true, false,
+		},
+		{
+			[]bpf.Instruction{number, bpf.StoreScratch{Src: bpf.RegA, N: 0}, allow},
+			[]bpf.Instruction{allow},
+			false, true,
+		},
+		{
+			[]bpf.Instruction{number, bpf.JumpIf{Cond: bpf.JumpEqual, Val: 5, SkipTrue: 1}, allow},
+			[]bpf.Instruction{allow},
+			false, true,
+		},
+	}
+	for i, tc := range cases {
+		first, err := bpf.Assemble(tc.first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := bpf.Assemble(tc.second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		difference, err := EquivalentPrograms(first, second, "amd64")
+		if (err != nil) != tc.err || (err == nil && (difference == nil) != tc.equivalent) {
+			t.Errorf(
+				"[%d/%d] Expected equivalent: %t (error: %t) got '%+v' (%v)",
+				i+1, len(cases),
+				tc.equivalent, tc.err,
+				difference, err,
+			)
+			continue
+		}
+		if difference == nil {
+			continue
+		}
+		// The counterexample must lead to the reported decisions
+		for j, program := range [][]bpf.RawInstruction{first, second} {
+			expected := []Decision{difference.First, difference.Second}[j]
+			got, err := Evaluate(program, difference.Data, "amd64")
+			if err != nil || got != expected {
+				t.Errorf(
+					"[%d/%d] program %d on %+v: Expected '%+v' got '%+v' (%v)",
+					i+1, len(cases), j+1, difference.Data,
+					expected, got, err,
+				)
+			}
+		}
+	}
+}
+
+type TestCasesWordConstraintsWitness struct {
+	constraints wordConstraints
+	expected    uint32
+	found       bool
+}
+
+func TestWordConstraintsWitness(t *testing.T) {
+	cases := []TestCasesWordConstraintsWitness{
+		{wordConstraints{high: ^uint32(0)}, 0, true},
+		{wordConstraints{low: 5, high: 4}, 0, false},
+		{wordConstraints{low: 3, high: 10, excluded: []uint32{3, 4, 6}}, 5, true},
+		{wordConstraints{low: 3, high: 4, excluded: []uint32{3, 4}}, 0, false},
+		// The two inequalities exclude bit 31, the other values are masked
+		{
+			wordConstraints{
+				high:     ^uint32(0),
+				equal:    maskedValue{mask: 1, value: 1},
+				notEqual: []maskedValue{{0x80000001, 1}, {0x80000000, 0x80000000}},
+			},
+			0, false,
+		},
+		{
+			wordConstraints{
+				low:      0x10,
+				high:     ^uint32(0),
+				equal:    maskedValue{mask: 0x11, value: 0x11},
+				notEqual: []maskedValue{{0x3, 0x1}, {0xff, 0x13}},
+			},
+			0x17, true,
+		},
+		{
+			wordConstraints{
+				low:      0x7fffffff,
+				high:     0x80000000,
+				notEqual: []maskedValue{{0x80000000, 0}},
+				excluded: []uint32{0x80000000},
+			},
+			0, false,
+		},
+	}
+	for i, tc := range cases {
+		got, found, err := tc.constraints.witness()
+		if err != nil || got != tc.expected || found != tc.found {
+			t.Errorf(
+				"[%d/%d] Expected '0x%x, %t' got '0x%x, %t' (%v)",
+				i+1, len(cases),
+				tc.expected, tc.found,
+				got, found, err,
+			)
+		}
+	}
+}
+
+func TestFilterEquivalent(t *testing.T) {
+	source := explainedFilter()
+	optimized := explainedFilter()
+	optimized.Optimize()
+	difference, err := source.Equivalent(&optimized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Optimize puts the more precise read rule first
+	if difference == nil || difference.Data.Number != unix.SYS_READ || difference.Data.Arg0 != 3 {
+		t.Fatalf("Expected a difference on read(3), got %+v", difference)
+	}
+
+	// Only the order of rules on different syscalls changes
+	reordered := explainedFilter()
+	reordered.Elements = []FilterElement{
+		reordered.Elements[0],
+		{
+			Match:    []SyscallCallFilter{reordered.Elements[1].Match[1]},
+			Decision: reordered.Elements[1].Decision,
+		},
+		{
+			Match:    []SyscallCallFilter{reordered.Elements[1].Match[0]},
+			Decision: reordered.Elements[1].Decision,
+		},
+	}
+	difference, err = source.Equivalent(&reordered)
+	if err != nil || difference != nil {
+		t.Errorf("Expected equivalent filters, got %+v (%v)", difference, err)
+	}
+}
+
+func TestOptimizeKeepsOrderedDecisions(t *testing.T) {
+	filter := explainedFilter()
+	filter.mergeAllDuplicatesDecisions()
+	filter.splitOrderElements()
+	ordered := filter.clone()
+	filter.mergeConsecutiveDuplicateDecisions()
+	for x := range filter.Elements {
+		filter.Elements[x].keepLeastPreciseMatch()
+	}
+	difference, err := ordered.Equivalent(&filter)
+	if err != nil || difference != nil {
+		t.Errorf("Expected equivalent filters, got %+v (%v)", difference, err)
+	}
+}
+
+// randomArgument returns an argument matcher on a few values, so that the
+// matchers of a random Filter overlap.
+func randomArgument(random *rand.Rand) SyscallArgument {
+	values := []uintptr{0, 1, 2, 0x7fffffff, 0x80000000, ^uintptr(0)}
+	value := values[random.Intn(len(values))]
+	switch random.Intn(6) {
+	case 0:
+		return Equal(value)
+	case 1:
+		return NotEqual(value)
+	case 2:
+		mask := values[random.Intn(len(values))] | 1
+		return MaskedEqual(mask, value&mask)
+	case 3:
+		return LessThan(value)
+	case 4:
+		return GreaterThan(value)
+	default:
+		return Any()
+	}
+}
+
+func randomFilter(random *rand.Rand) Filter {
+	decisions := []Decision{{Type: Allow}, {Type: Errno, Data: 1}, {Type: Log}}
+	filter := Filter{Architecture: "amd64", DefaultDecision: Decision{Type: KillProcess}}
+	for i := 0; i < 2+random.Intn(2); i++ {
+		element := FilterElement{Decision: decisions[random.Intn(len(decisions))]}
+		for j := 0; j < 1+random.Intn(2); j++ {
+			syscall := SyscallCallFilter{Number: uint(random.Intn(2))}
+			for k := range syscall.Args {
+				syscall.Args[k] = Any()
+			}
+			for k := 0; k < 2; k++ {
+				syscall.Args[random.Intn(2)] = randomArgument(random)
+			}
+			element.Match = append(element.Match, syscall)
+		}
+		filter.Elements = append(filter.Elements, element)
+	}
+	return filter
+}
+
+func TestOptimizeKeepsOrderedDecisionsRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		filter := randomFilter(random)
+		source := filter.clone()
+		difference, err := source.Equivalent(&filter)
+		if err != nil || difference != nil {
+			t.Fatalf("[%d] %+v: Expected a filter equivalent to itself, got %+v (%v)", i, source, difference, err)
+		}
+		filter.mergeAllDuplicatesDecisions()
+		filter.splitOrderElements()
+		ordered := filter.clone()
+		filter.mergeConsecutiveDuplicateDecisions()
+		for x := range filter.Elements {
+			filter.Elements[x].keepLeastPreciseMatch()
+		}
+		difference, err = ordered.Equivalent(&filter)
+		if err != nil || difference != nil {
+			t.Fatalf("[%d] %+v: Expected equivalent filters, got %+v (%v)", i, ordered, difference, err)
+		}
+	}
+}
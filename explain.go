@@ -0,0 +1,132 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+)
+
+// RuleMatch locates a SyscallCallFilter of a Filter matching a syscall
+type RuleMatch struct {
+	// Element is the index of the FilterElement in the Filter Elements, or X32Elements if X32
+	// is set, or ArchElements of Arch if Arch is set
+	Element int
+	// Match is the index of the SyscallCallFilter in the FilterElement Match
+	Match int
+	// X32 tells if the element is part of the Filter X32Elements
+	X32 bool
+	// Arch is the architecture of the element if it is part of the Filter ArchElements
+	Arch string
+	// Rule is the matching SyscallCallFilter, as given in the Filter. Rules of the
+	// Elements applied to a secondary architecture or to x32 syscalls are numbered
+	// for the Architecture.
+	Rule SyscallCallFilter
+	// Decision is the decision of the FilterElement
+	Decision Decision
+}
+
+// Explanation tells why a Filter takes a decision on a syscall
+type Explanation struct {
+	// Decision is the decision taken on the syscall
+	Decision Decision
+	// Arch is the architecture of the syscall among the Filter ones, empty if the
+	// BadArchDecision applies as it is none of them
+	Arch string
+	// Matched is the rule deciding on the syscall, nil if the DefaultDecision or the
+	// BadArchDecision applies
+	Matched *RuleMatch
+	// Shadowed are the other rules matching the syscall, which don't apply as
+	// they come after the Matched one
+	Shadowed []RuleMatch
+}
+
+// matchesCall tells if the SyscallCallFilter, compiled for the given
+// architecture, matches the syscall.
+func (a SyscallCallFilter) matchesCall(number uint, args [6]uint64, arch string) bool {
+	if a.Number != number {
+		return false
+	}
+	for i, arg := range a.Args {
+		if !arg.matchesOn(args[i], arch) {
+			return false
+		}
+	}
+	return true
+}
+
+// Explain tells which rule of the Filter decides on the syscall described by data, as
+// the compiled Filter does: data.Arch selects the Architecture or one of the
+// SecondaryArchitectures, other architectures get the BadArchDecision, and amd64
+// syscalls having lowlevel.X32_SYSCALL_BIT set in data.Number follow the X32Policy,
+// but for the -1 number of syscalls skipped by a tracer.
+// The instruction pointer of data is ignored.
+//
+// The explanation follows the Filter as it is, Elements being checked in order,
+// so it tells the behaviour of the compiled Filter whether it has been optimized or not.
+// An error is returned if the rules of the architecture can't be compiled.
+func (f *Filter) Explain(data lowlevel.SeccompData) (Explanation, error) {
+	number := uint(uint32(data.Number))
+	args := [6]uint64{data.Arg0, data.Arg1, data.Arg2, data.Arg3, data.Arg4, data.Arg5}
+	for _, arch := range append([]string{f.Architecture}, f.SecondaryArchitectures...) {
+		auditArch := lowlevel.GetAuditArch(arch)
+		if auditArch == 0 || auditArch != data.Arch {
+			continue
+		}
+		explanation := Explanation{Decision: f.DefaultDecision, Arch: arch}
+		// The rules as given in the Filter, and as compiled for the syscall
+		given, table := f.Elements, arch
+		var x32 bool
+		var archElements string
+		if arch == "amd64" && number != skippedSyscall && number&lowlevel.X32_SYSCALL_BIT != 0 {
+			switch f.X32Policy {
+			case X32Deny:
+				explanation.Decision = f.badArchDecision()
+				return explanation, nil
+			case X32Native:
+				table = "x32"
+			case X32Rules:
+				given, table, x32 = f.X32Elements, "", true
+			default:
+				return Explanation{}, fmt.Errorf("unknown x32 policy %d", f.X32Policy)
+			}
+		} else if elements, ok := f.ArchElements[arch]; ok && arch != f.Architecture {
+			given, table, archElements = elements, "", arch
+		}
+		compiled := given
+		if table != "" {
+			var err error
+			compiled, err = f.elementsFor(table)
+			if err != nil {
+				return Explanation{}, err
+			}
+		}
+		if err := checkArguments(compiled, arch); err != nil {
+			return Explanation{}, err
+		}
+		for i, element := range compiled {
+			for j, rule := range element.Match {
+				if !rule.matchesCall(number, args, arch) {
+					continue
+				}
+				match := RuleMatch{
+					Element:  i,
+					Match:    j,
+					X32:      x32,
+					Arch:     archElements,
+					Rule:     given[i].Match[j],
+					Decision: element.Decision,
+				}
+				if explanation.Matched == nil {
+					explanation.Matched = &match
+					explanation.Decision = element.Decision
+				} else {
+					explanation.Shadowed = append(explanation.Shadowed, match)
+				}
+			}
+		}
+		return explanation, nil
+	}
+	return Explanation{Decision: f.badArchDecision()}, nil
+}
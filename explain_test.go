@@ -0,0 +1,213 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+func explainedFilter() Filter {
+	anyArgs := [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}
+	return Filter{
+		Architecture: "amd64",
+		Elements: []FilterElement{
+			{
+				Match: []SyscallCallFilter{
+					{Number: unix.SYS_GETPGID, Args: [6]SyscallArgument{GreaterThan(0x10), Any(), Any(), Any(), Any(), Any()}},
+				},
+				Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+			},
+			{
+				Match: []SyscallCallFilter{
+					{Number: unix.SYS_GETPGID, Args: anyArgs},
+					{Number: unix.SYS_READ, Args: anyArgs},
+				},
+				Decision: Decision{Type: Allow},
+			},
+			{
+				Match: []SyscallCallFilter{
+					{Number: unix.SYS_READ, Args: [6]SyscallArgument{Equal(3), Any(), Any(), Any(), Any(), Any()}},
+				},
+				Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+			},
+		},
+		DefaultDecision: Decision{Type: Errno, Data: uint16(unix.ENOSYS)},
+	}
+}
+
+type TestCasesExplain struct {
+	number   uint
+	arg0     uint64
+	expected Explanation
+}
+
+func TestFilterExplain(t *testing.T) {
+	filter := explainedFilter()
+	match := func(element, index int) RuleMatch {
+		return RuleMatch{
+			Element:  element,
+			Match:    index,
+			Rule:     filter.Elements[element].Match[index],
+			Decision: filter.Elements[element].Decision,
+		}
+	}
+	matched := func(element, index int) *RuleMatch {
+		m := match(element, index)
+		return &m
+	}
+	cases := []TestCasesExplain{
+		{
+			unix.SYS_GETPGID, 0x11,
+			Explanation{Decision: filter.Elements[0].Decision, Arch: "amd64", Matched: matched(0, 0), Shadowed: []RuleMatch{match(1, 0)}},
+		},
+		{
+			unix.SYS_GETPGID, 0x1,
+			Explanation{Decision: filter.Elements[1].Decision, Arch: "amd64", Matched: matched(1, 0)},
+		},
+		{
+			unix.SYS_READ, 3,
+			Explanation{Decision: filter.Elements[1].Decision, Arch: "amd64", Matched: matched(1, 1), Shadowed: []RuleMatch{match(2, 0)}},
+		},
+		{
+			unix.SYS_WRITE, 3,
+			Explanation{Decision: filter.DefaultDecision, Arch: "amd64"},
+		},
+	}
+	for i, tc := range cases {
+		got, err := filter.Explain(lowlevel.SeccompData{
+			Number: int32(tc.number),
+			Arch:   lowlevel.GetAuditArch("amd64"),
+			Arg0:   tc.arg0,
+		})
+		if err != nil || !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"[%d/%d]\n\tExpected: %+v\n\tGot:      %+v (%v)",
+				i+1, len(cases),
+				tc.expected,
+				got,
+				err,
+			)
+		}
+	}
+}
+
+func TestFilterExplainMatchesCompiled(t *testing.T) {
+	source := explainedFilter()
+	optimized := explainedFilter()
+	optimized.Optimize()
+	for _, filter := range []Filter{source, optimized} {
+		program, err := filter.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, number := range []uint{unix.SYS_GETPGID, unix.SYS_READ, unix.SYS_WRITE} {
+			for _, arg0 := range []uint64{0, 3, 0x11, 0x100000003} {
+				data := lowlevel.SeccompData{
+					Number: int32(number),
+					Arch:   lowlevel.GetAuditArch("amd64"),
+					Arg0:   arg0,
+				}
+				expected, err := Evaluate(program, data, "amd64")
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := filter.Explain(data)
+				if err != nil || got.Decision != expected {
+					t.Errorf(
+						"syscall %d(0x%x) on %+v: Expected '%+v' got '%+v'",
+						number, arg0, filter.Elements, expected, got,
+					)
+				}
+			}
+		}
+	}
+}
+
+func TestFilterExplainArchitectures(t *testing.T) {
+	x32Rule := SyscallCallFilter{Number: unix.SYS_READ | lowlevel.X32_SYSCALL_BIT, Args: anyArgs()}
+	filters := map[X32Policy]Filter{}
+	for _, policy := range []X32Policy{X32Deny, X32Native, X32Rules} {
+		filter := explainedFilter()
+		filter.SecondaryArchitectures = []string{"386"}
+		filter.ArchElements = map[string][]FilterElement{
+			"386": {{Match: []SyscallCallFilter{{Number: 3, Args: anyArgs()}}, Decision: Decision{Type: Log}}},
+		}
+		filter.X32Policy = policy
+		filter.X32Elements = []FilterElement{{Match: []SyscallCallFilter{x32Rule}, Decision: Decision{Type: Trap}}}
+		filter.BadArchDecision = &Decision{Type: KillThread}
+		filters[policy] = filter
+	}
+	native := filters[X32Native]
+	cases := []struct {
+		filter   Filter
+		arch     string
+		number   uint
+		expected Explanation
+	}{
+		{native, "386", 3, Explanation{
+			Decision: Decision{Type: Log},
+			Arch:     "386",
+			Matched: &RuleMatch{
+				Arch:     "386",
+				Rule:     native.ArchElements["386"][0].Match[0],
+				Decision: Decision{Type: Log},
+			},
+		}},
+		{native, "386", 4, Explanation{Decision: native.DefaultDecision, Arch: "386"}},
+		{native, "arm64", unix.SYS_READ, Explanation{Decision: Decision{Type: KillThread}}},
+		{filters[X32Deny], "amd64", x32Rule.Number, Explanation{Decision: Decision{Type: KillThread}, Arch: "amd64"}},
+		{native, "amd64", x32Rule.Number, Explanation{
+			Decision: native.Elements[1].Decision,
+			Arch:     "amd64",
+			Matched: &RuleMatch{
+				Element:  1,
+				Match:    1,
+				Rule:     native.Elements[1].Match[1],
+				Decision: native.Elements[1].Decision,
+			},
+			Shadowed: []RuleMatch{{
+				Element:  2,
+				Rule:     native.Elements[2].Match[0],
+				Decision: native.Elements[2].Decision,
+			}},
+		}},
+		{filters[X32Rules], "amd64", x32Rule.Number, Explanation{
+			Decision: Decision{Type: Trap},
+			Arch:     "amd64",
+			Matched:  &RuleMatch{X32: true, Rule: x32Rule, Decision: Decision{Type: Trap}},
+		}},
+	}
+	for i, tc := range cases {
+		data := lowlevel.SeccompData{Number: int32(tc.number), Arch: lowlevel.GetAuditArch(tc.arch), Arg0: 3}
+		got, err := tc.filter.Explain(data)
+		if err != nil || !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"[%d/%d]\n\tExpected: %+v\n\tGot:      %+v (%v)",
+				i+1, len(cases),
+				tc.expected,
+				got,
+				err,
+			)
+			continue
+		}
+		program, err := tc.filter.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		compiled, err := Evaluate(program, data, "amd64")
+		if err != nil || compiled != got.Decision {
+			t.Errorf("[%d/%d] Expected the compiled decision '%+v' got '%+v' (%v)", i+1, len(cases), got.Decision, compiled, err)
+		}
+	}
+
+	unknown := native
+	unknown.X32Policy = 42
+	data := lowlevel.SeccompData{Number: int32(x32Rule.Number), Arch: lowlevel.GetAuditArch("amd64")}
+	if _, err := unknown.Explain(data); err == nil {
+		t.Error("Expected an error for an unknown x32 policy")
+	}
+}
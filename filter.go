@@ -8,10 +8,25 @@ import (
 
 	"github.com/diconico07/goseccomp/lowlevel"
 	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
 )
 
 var CurrentArch string = runtime.GOARCH
 
+// X32Policy tells how an amd64 Filter handles the x32 ABI syscalls, which share
+// the amd64 audit architecture but have lowlevel.X32_SYSCALL_BIT set in their number.
+type X32Policy uint8
+
+const (
+	// X32Deny applies the BadArchDecision to any x32 syscall
+	X32Deny X32Policy = iota
+	// X32Native applies the Filter Elements to the x32 syscalls, numbers are
+	// translated by name to the x32 numbering
+	X32Native
+	// X32Rules applies the Filter X32Elements to the x32 syscalls
+	X32Rules
+)
+
 // Filter represents a full fledged seccomp filter
 type Filter struct {
 	// Elements is a slice of FilterElements that build the filter
@@ -19,8 +34,43 @@ type Filter struct {
 	// DefaultDecision is the decision that get applied if nothing match
 	DefaultDecision Decision
 	// Architecture is the architecture for which the filter is designed.
-	// If Architecture doesn't match process will be killed.
+	// If Architecture doesn't match the BadArchDecision applies.
 	Architecture string
+	// SecondaryArchitectures are other architectures the filter also applies to,
+	// such as "386" on "amd64" or "arm" on "arm64". Syscall numbers of the
+	// Elements are translated by name from the Architecture numbering, compiling
+	// fails if a syscall is missing on a secondary architecture, its rules must
+	// then be given in ArchElements.
+	SecondaryArchitectures []string
+	// ArchElements are the FilterElements of some SecondaryArchitectures, numbered
+	// for them, which replace the translated Elements on these architectures.
+	ArchElements map[string][]FilterElement
+	// X32Policy is the handling of the x32 syscalls when filtering amd64
+	X32Policy X32Policy
+	// X32Elements are the FilterElements applied to the x32 syscalls with the
+	// X32Rules policy, their syscall numbers are the x32 ones (see [NewSyscallCallFilter]
+	// with the "x32" architecture).
+	X32Elements []FilterElement
+	// BadArchDecision is the decision that get applied to syscalls of other
+	// architectures, KillProcess if nil
+	BadArchDecision *Decision
+	// Flags are SECCOMP_FILTER_FLAG_* constants given to the kernel when inserting
+	// the Filter, among lowlevel.SECCOMP_FILTER_FLAG_LOG, SECCOMP_FILTER_FLAG_SPEC_ALLOW
+	// and SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV, the last one only applying with the
+	// UserNotify decision. The Insert methods set the other flags themselves.
+	Flags uint
+}
+
+// filterFlags are the flags that can be set in the Filter Flags
+const filterFlags = lowlevel.SECCOMP_FILTER_FLAG_LOG |
+	lowlevel.SECCOMP_FILTER_FLAG_SPEC_ALLOW |
+	lowlevel.SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV
+
+func (f *Filter) badArchDecision() Decision {
+	if f.BadArchDecision == nil {
+		return Decision{Type: KillProcess}
+	}
+	return *f.BadArchDecision
 }
 
 func (f *Filter) mergeAllDuplicatesDecisions() {
@@ -62,17 +112,33 @@ func (f *Filter) splitOrderElements() {
 	var lastOrderedFilter int = 0
 OUTER:
 	for {
-		for x, filter := range f.Elements[lastOrderedFilter:] {
+		for _, filter := range f.Elements[lastOrderedFilter:] {
+			// Every filter before lastOrderedFilter is ordered, so it is the
+			// position of the current one.
+			position := lastOrderedFilter
 			for i, element := range filter.Match {
 				bestPosition := 0
-				for j, mFilter := range f.Elements[lastOrderedFilter:] {
+				for j, mFilter := range f.Elements[position+1:] {
+					morePrecise, overlapping := false, false
 					for _, mElement := range mFilter.Match {
-						if element.Match(mElement) {
-							if !element.IsMorePrecise(mElement) {
-								bestPosition = j + 1
-							}
+						if !element.Match(mElement) {
+							continue
+						}
+						if mElement.IsMorePrecise(element) && !element.IsMorePrecise(mElement) {
+							morePrecise = true
+						} else if mFilter.Decision != filter.Decision {
+							overlapping = true
 						}
 					}
+					// Only strictly more precise matches need to come first, moving
+					// past a partially overlapping match with another decision would
+					// change the decision on their intersection.
+					if overlapping {
+						break
+					}
+					if morePrecise {
+						bestPosition = position + j + 2
+					}
 				}
 				if bestPosition != 0 {
 					newFilter := FilterElement{
@@ -81,9 +147,9 @@ OUTER:
 						},
 						Decision: filter.Decision,
 					}
-					f.Elements[x].Match = append(
-						f.Elements[x].Match[:i],
-						f.Elements[x].Match[i+1:]...,
+					f.Elements[position].Match = append(
+						f.Elements[position].Match[:i],
+						f.Elements[position].Match[i+1:]...,
 					)
 					if bestPosition == len(f.Elements) {
 						f.Elements = append(f.Elements, newFilter)
@@ -103,54 +169,107 @@ OUTER:
 	}
 }
 
+// clone returns a copy of the Filter not sharing its elements
+func (f *Filter) clone() Filter {
+	clone := *f
+	clone.Elements = make([]FilterElement, len(f.Elements))
+	for i, element := range f.Elements {
+		clone.Elements[i] = FilterElement{
+			Match:    append([]SyscallCallFilter(nil), element.Match...),
+			Decision: element.Decision,
+		}
+	}
+	if f.ArchElements != nil {
+		clone.ArchElements = make(map[string][]FilterElement, len(f.ArchElements))
+		for arch, elements := range f.ArchElements {
+			secondary := Filter{Elements: elements}
+			clone.ArchElements[arch] = secondary.clone().Elements
+		}
+	}
+	return clone
+}
+
 // Optimize re-order filter elements to have an ordered Filter that
 // take all given decisions accordingly, spurious filter elements are removed.
+//
+// When built with the goseccomp_debug tag, Optimize panics if the passes after
+// the re-ordering change a decision of the Filter, or if this can't be checked.
 func (f *Filter) Optimize() {
 	f.mergeAllDuplicatesDecisions()
 	f.splitOrderElements()
+	// The previous passes change the order of the rules on purpose,
+	// the following ones must keep the decisions.
+	var ordered Filter
+	if debugOptimize {
+		ordered = f.clone()
+	}
 	f.mergeConsecutiveDuplicateDecisions()
 
 	for x := range f.Elements {
 		f.Elements[x].keepLeastPreciseMatch()
 	}
 
+	if debugOptimize && f.Architecture != "" {
+		// Filters that don't compile can't be checked, whether optimized or not
+		if _, err := ordered.compile(); err == nil {
+			difference, err := ordered.Equivalent(f)
+			if err != nil {
+				panic(fmt.Sprintf("goseccomp: Optimize result can't be checked: %v", err))
+			}
+			if difference != nil {
+				panic(fmt.Sprintf(
+					"goseccomp: Optimize changed the decision on %+v from '%+v' to '%+v'",
+					difference.Data, difference.First, difference.Second,
+				))
+			}
+		}
+	}
+
+	if len(f.X32Elements) != 0 {
+		x32 := Filter{Architecture: f.Architecture, Elements: f.X32Elements}
+		x32.Optimize()
+		f.X32Elements = x32.Elements
+	}
+
+	for arch, elements := range f.ArchElements {
+		secondary := Filter{Architecture: arch, Elements: elements}
+		secondary.Optimize()
+		f.ArchElements[arch] = secondary.Elements
+	}
 }
 
 // Compile produce a slice of BPF raw instructions ready to be injected
 // into the seccomp syscall.
+//
+// A program longer than lowlevel.BPF_MAXINSNS instructions is refused with a
+// *ProgramTooLargeError. Use [Filter.CompileStacked] to also check the limit of
+// the filters stacked on a thread.
+//
+// Syscall arguments are 32 bits wide on 32 bits architectures, argument checks
+// with a value or mask not fitting in 32 bits give an error there.
 func (f *Filter) Compile() ([]bpf.RawInstruction, error) {
-	if !lowlevel.SeccompGetActionAvail(uint(f.DefaultDecision.Type)) {
-		return nil, fmt.Errorf(
-			"action '%v' unavailable",
-			f.DefaultDecision.Type,
-		)
-	}
-	for _, filter := range f.Elements {
-		if !lowlevel.SeccompGetActionAvail(uint(filter.Decision.Type)) {
+	for _, decision := range []Decision{f.DefaultDecision, f.badArchDecision()} {
+		if !lowlevel.SeccompGetActionAvail(uint(decision.Type)) {
 			return nil, fmt.Errorf(
 				"action '%v' unavailable",
-				filter.Decision.Type,
+				decision.Type,
 			)
 		}
 	}
-	// Need to drop the redundant filters and order conflicting ones
-	bpfProg := []bpf.Instruction{
-		lowlevel.LoadSeccompDataField("Arch", false, f.Architecture),
-		bpf.JumpIf{
-			Cond:     bpf.JumpEqual,
-			SkipTrue: 1,
-			Val:      lowlevel.GetAuditArch(f.Architecture),
-		},
-		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
-		lowlevel.LoadSeccompDataField("Number", false, f.Architecture),
+	for _, elements := range f.elementLists() {
+		for _, filter := range elements {
+			if !lowlevel.SeccompGetActionAvail(uint(filter.Decision.Type)) {
+				return nil, fmt.Errorf(
+					"action '%v' unavailable",
+					filter.Decision.Type,
+				)
+			}
+		}
 	}
-	for _, filter := range f.Elements {
-		bpfProg = append(bpfProg, filter.compile(f.Architecture)...)
+	bpfProg, err := f.compile()
+	if err != nil {
+		return nil, err
 	}
-	bpfProg = append(
-		bpfProg,
-		f.DefaultDecision.compile(),
-	)
 
 	rawBpf, err := bpf.Assemble(bpfProg)
 	if err != nil {
@@ -159,29 +278,368 @@ func (f *Filter) Compile() ([]bpf.RawInstruction, error) {
 	return rawBpf, nil
 }
 
-// Insert compiles and insert the given Filter in the current thread.
-// Will set the NoNewPrivs bit. To be effective this must be done before
-// any thread gets created.
-func (f *Filter) Insert() error {
-	err := lowlevel.NoNewPrivs()
+// compile produces the BPF program of the Filter, without checking
+// the decisions availability.
+func (f *Filter) compile() ([]bpf.Instruction, error) {
+	archs := append([]string{f.Architecture}, f.SecondaryArchitectures...)
+	if err := f.checkArchElements(); err != nil {
+		return nil, err
+	}
+	sections := make([][]bpf.Instruction, len(archs))
+	seen := make(map[uint32]bool, len(archs))
+	for i, arch := range archs {
+		auditArch := lowlevel.GetAuditArch(arch)
+		if auditArch == 0 {
+			return nil, fmt.Errorf("unknown architecture '%s'", arch)
+		}
+		if seen[auditArch] {
+			return nil, fmt.Errorf("architecture '%s' is given twice", arch)
+		}
+		seen[auditArch] = true
+		if lowlevel.ArchIsLittleEndian(arch) != lowlevel.ArchIsLittleEndian(f.Architecture) {
+			return nil, fmt.Errorf(
+				"architecture '%s' endianness differs from '%s'",
+				arch, f.Architecture,
+			)
+		}
+		section, err := f.compileArch(arch)
+		if err != nil {
+			return nil, err
+		}
+		sections[i] = section
+	}
+
+	bpfProg := []bpf.Instruction{
+		lowlevel.LoadSeccompDataField("Arch", false, f.Architecture),
+	}
+	if len(archs) == 1 {
+		bpfProg = append(
+			bpfProg,
+			bpf.JumpIf{
+				Cond:     bpf.JumpEqual,
+				SkipTrue: 1,
+				Val:      lowlevel.GetAuditArch(f.Architecture),
+			},
+		)
+	} else {
+		// Dispatch on the architecture, unconditional jumps are used to reach
+		// the sections as they may be too far away for a conditional one.
+		var sectionOffset uint32 = 0
+		for i, arch := range archs {
+			bpfProg = append(
+				bpfProg,
+				bpf.JumpIf{
+					Cond:     bpf.JumpNotEqual,
+					SkipTrue: 1,
+					Val:      lowlevel.GetAuditArch(arch),
+				},
+				bpf.Jump{Skip: uint32(2*(len(archs)-i-1)+1) + sectionOffset},
+			)
+			sectionOffset += uint32(len(sections[i]))
+		}
+	}
+	bpfProg = append(bpfProg, f.badArchDecision().compile())
+	for _, section := range sections {
+		bpfProg = append(bpfProg, section...)
+	}
+	bpfProg, err := relaxJumps(bpfProg)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(bpfProg) > lowlevel.BPF_MAXINSNS {
+		return nil, &ProgramTooLargeError{
+			Instructions: len(bpfProg),
+			Limit:        lowlevel.BPF_MAXINSNS,
+			Elements:     f.elementCosts(),
+		}
+	}
+	return bpfProg, nil
+}
+
+// checkArchElements checks the ArchElements are given for SecondaryArchitectures
+func (f *Filter) checkArchElements() error {
+	for arch := range f.ArchElements {
+		secondary := false
+		for _, name := range f.SecondaryArchitectures {
+			secondary = secondary || name == arch
+		}
+		if !secondary {
+			return fmt.Errorf("ArchElements given for '%s' which isn't a secondary architecture", arch)
+		}
 	}
-	var flags uint
+	return nil
+}
+
+// elementsFor returns the Elements numbered for the given architecture
+// syscall table, or its ArchElements if any.
+func (f *Filter) elementsFor(arch string) ([]FilterElement, error) {
+	if arch == f.Architecture {
+		return f.Elements, nil
+	}
+	// x32 syscalls have their own X32Elements
+	rules := "X32Elements"
+	if arch != "x32" {
+		if elements, ok := f.ArchElements[arch]; ok {
+			return elements, nil
+		}
+		rules = "ArchElements"
+	}
+	elements := make([]FilterElement, 0, len(f.Elements))
 	for _, filter := range f.Elements {
-		if filter.Decision.Type == UserNotify {
-			flags |= lowlevel.SECCOMP_FILTER_FLAG_NEW_LISTENER
+		element := FilterElement{Decision: filter.Decision}
+		for _, syscall := range filter.Match {
+			name, ok := syscall.Name(f.Architecture)
+			if !ok {
+				return nil, fmt.Errorf(
+					"syscall %d has no name on architecture '%s'",
+					syscall.Number, f.Architecture,
+				)
+			}
+			number, ok := lowlevel.SyscallNumber(arch, name)
+			if !ok {
+				return nil, fmt.Errorf(
+					"syscall '%s' doesn't exist on architecture '%s', its rules must be given in %s",
+					name, arch, rules,
+				)
+			}
+			syscall.Number = number
+			element.Match = append(element.Match, syscall)
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// checkArguments checks that the argument checks of the elements fit the
+// architecture they are compiled for, rather than being truncated.
+func checkArguments(elements []FilterElement, arch string) error {
+	for _, element := range elements {
+		for _, syscall := range element.Match {
+			for i, arg := range syscall.Args {
+				if !arg.fitsArch(arch) {
+					return fmt.Errorf(
+						"argument %d of syscall %d doesn't fit in 32 bits on architecture '%s'",
+						i, syscall.Number, arch,
+					)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// skippedSyscall is the syscall number the filter is run again with when a
+// tracer skips a syscall after a Trace decision, -1 as seen by the filter.
+const skippedSyscall = 0xffffffff
+
+// compileArch produces the filter section of a single architecture, starting
+// right after the architecture check. On amd64, the skipped syscall number has
+// the x32 bit set but goes to the native rules, as with libseccomp.
+func (f *Filter) compileArch(arch string) ([]bpf.Instruction, error) {
+	elements, err := f.elementsFor(arch)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkArguments(elements, arch); err != nil {
+		return nil, err
+	}
+	instructions := []bpf.Instruction{
+		lowlevel.LoadSeccompDataField("Number", false, arch),
+	}
+	if arch == "amd64" {
+		x32, err := f.compileX32()
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(
+			instructions,
+			jumpIf(bpf.JumpEqual, uint(len(x32))+1, 0, skippedSyscall),
+			jumpIf(bpf.JumpBitsSet, 0, uint(len(x32)), lowlevel.X32_SYSCALL_BIT),
+		)
+		instructions = append(instructions, x32...)
+	}
+	return append(instructions, compileElements(elements, f.DefaultDecision, arch)...), nil
+}
+
+// compileX32 produces the checks of the x32 syscalls, they start with
+// the syscall number loaded.
+func (f *Filter) compileX32() ([]bpf.Instruction, error) {
+	switch f.X32Policy {
+	case X32Deny:
+		return []bpf.Instruction{f.badArchDecision().compile()}, nil
+	case X32Native:
+		elements, err := f.elementsFor("x32")
+		if err != nil {
+			return nil, err
 		}
+		return compileElements(elements, f.DefaultDecision, "amd64"), nil
+	case X32Rules:
+		return compileElements(f.X32Elements, f.DefaultDecision, "amd64"), nil
+	default:
+		return nil, fmt.Errorf("unknown x32 policy %d", f.X32Policy)
+	}
+}
+
+// compileElements produces the checks of the elements followed by the default decision,
+// using a binary search on the syscall number when it is cheaper than linear checks.
+func compileElements(elements []FilterElement, defaultDecision Decision, arch string) []bpf.Instruction {
+	var instructions []bpf.Instruction
+	for _, filter := range elements {
+		instructions = append(instructions, filter.compile(arch)...)
+	}
+	instructions = append(instructions, defaultDecision.compile())
+	tree := compileTree(elements, defaultDecision, arch)
+	if worstCaseLength(tree) < worstCaseLength(instructions) {
+		return tree
+	}
+	return instructions
+}
+
+// elementLists returns the element lists of the Filter, without
+// concatenating them as the caller owns their backing arrays.
+func (f *Filter) elementLists() [][]FilterElement {
+	lists := [][]FilterElement{f.Elements, f.X32Elements}
+	for _, elements := range f.ArchElements {
+		lists = append(lists, elements)
+	}
+	return lists
+}
+
+func (f *Filter) usesUserNotify() bool {
+	for _, elements := range f.elementLists() {
+		for _, filter := range elements {
+			if filter.Decision.Type == UserNotify {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *Filter) insert(flags uint) (int, error) {
+	if f.Flags&^filterFlags != 0 {
+		return 0, fmt.Errorf("flags 0x%x can't be set in the Filter Flags", f.Flags&^filterFlags)
 	}
 	compiled, err := f.Compile()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	// Unprivileged threads need NoNewPrivs to insert a filter, and the threads
+	// synchronized with SECCOMP_FILTER_FLAG_TSYNC get it from the calling thread:
+	// both have to run on the same thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := lowlevel.NoNewPrivs(); err != nil {
+		return 0, err
+	}
+	flags |= f.Flags
+	if f.usesUserNotify() {
+		flags |= lowlevel.SECCOMP_FILTER_FLAG_NEW_LISTENER
+		if flags&lowlevel.SECCOMP_FILTER_FLAG_TSYNC != 0 {
+			// The kernel can't return both a listener and a thread id
+			flags |= lowlevel.SECCOMP_FILTER_FLAG_TSYNC_ESRCH
+		}
+	} else {
+		// The kernel refuses it without a listener
+		flags &^= lowlevel.SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV
+	}
+	fd, err := lowlevel.SeccompSetModeFilter(compiled, flags)
+	if err == unix.ESRCH && flags&lowlevel.SECCOMP_FILTER_FLAG_TSYNC != 0 {
+		err = &ThreadSyncError{Tid: fd}
+	}
+	if err == unix.ENOMEM {
+		// The kernel refuses a program once the thread filters exceed the limit,
+		// the filters already installed on the current thread can't be read to
+		// check it beforehand
+		err = &ProgramTooLargeError{
+			Instructions: len(compiled),
+			Limit:        lowlevel.MAX_INSNS_PER_PATH,
+			Err:          err,
+			Elements:     f.elementCosts(),
+		}
 	}
-	// TODO: Handle file descriptor when using new listener
-	_, err = lowlevel.SeccompSetModeFilter(compiled, flags)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return fd, nil
+}
 
+func (f *Filter) insertWithListener(flags uint) (*Listener, error) {
+	fd, err := f.insert(flags)
+	if err != nil {
+		return nil, err
+	}
+	if !f.usesUserNotify() {
+		return nil, nil
+	}
+	return NewListener(fd), nil
+}
+
+func closeListener(listener *Listener, err error) error {
+	if err != nil {
+		return err
+	}
+	if listener != nil {
+		return listener.Close()
+	}
 	return nil
 }
+
+// Insert compiles and insert the given Filter in the current thread.
+// Will set the NoNewPrivs bit. To be effective this must be done before
+// any thread gets created, which the Go runtime does early: use
+// [Filter.InsertAllThreads] to filter the whole process.
+//
+// The filters already installed on the thread aren't known, if the Filter
+// can't be stacked on them a *ProgramTooLargeError wrapping the kernel ENOMEM
+// is returned, see [Filter.CompileStacked] to check it beforehand.
+//
+// If the Filter uses the UserNotify decision, the notification listener
+// is closed right away, so notified syscalls fail with ENOSYS. Use
+// [Filter.InsertWithListener] to supervise them.
+func (f *Filter) Insert() error {
+	return closeListener(f.InsertWithListener())
+}
+
+// InsertWithListener behaves like [Filter.Insert] but returns the [Listener]
+// receiving the notifications of the UserNotify decisions.
+//
+// If the Filter doesn't use the UserNotify decision, the returned Listener is nil.
+func (f *Filter) InsertWithListener() (*Listener, error) {
+	return f.insertWithListener(0)
+}
+
+// ThreadSyncError is returned when a Filter can't be inserted on all the threads
+// of the process, as one of them has seccomp filters that the calling thread
+// doesn't have, or is in seccomp strict mode.
+type ThreadSyncError struct {
+	// Tid is the id of the thread that couldn't be synchronized, the kernel
+	// doesn't tell it when the Filter uses the UserNotify decision, Tid is 0 then.
+	Tid int
+}
+
+func (e *ThreadSyncError) Error() string {
+	if e.Tid == 0 {
+		return "a thread can't be synchronized with the seccomp filters"
+	}
+	return fmt.Sprintf("thread %d can't be synchronized with the seccomp filters", e.Tid)
+}
+
+// InsertAllThreads behaves like [Filter.Insert] but synchronizes all the threads
+// of the process with the seccomp filters of the current thread, the Filter
+// included, and sets their NoNewPrivs bit. Threads created by the Go runtime
+// before the call are thus filtered too.
+//
+// If a thread can't be synchronized, a *ThreadSyncError is returned and the
+// Filter isn't inserted on any thread.
+func (f *Filter) InsertAllThreads() error {
+	return closeListener(f.InsertAllThreadsWithListener())
+}
+
+// InsertAllThreadsWithListener behaves like [Filter.InsertAllThreads] but returns
+// the [Listener] receiving the notifications of the UserNotify decisions, see
+// [Filter.InsertWithListener]. Using it with the UserNotify decision needs
+// Linux 5.7 or later.
+func (f *Filter) InsertAllThreadsWithListener() (*Listener, error) {
+	return f.insertWithListener(lowlevel.SECCOMP_FILTER_FLAG_TSYNC)
+}
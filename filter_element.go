@@ -35,10 +35,14 @@ func (f *FilterElement) keepLeastPreciseMatch() {
 OUTER:
 	for _, filter := range f.Match {
 		for i, mFilter := range newMatch {
-			if filter.Match(mFilter) {
-				if mFilter.IsMorePrecise(filter) {
-					newMatch[i] = filter
-				}
+			if !filter.Match(mFilter) {
+				continue
+			}
+			if filter.IsMorePrecise(mFilter) {
+				continue OUTER
+			}
+			if mFilter.IsMorePrecise(filter) {
+				newMatch[i] = filter
 				continue OUTER
 			}
 		}
@@ -31,7 +31,7 @@ func TestFilterElementKeepLeastPreciseMatch(t *testing.T) {
 					},
 					{
 						Args: [6]SyscallArgument{
-							{4, false}, Any(), Any(), Any(), Any(), Any(),
+							{Value: 4}, Any(), Any(), Any(), Any(), Any(),
 						},
 						Number: 1,
 					},
@@ -43,7 +43,7 @@ func TestFilterElementKeepLeastPreciseMatch(t *testing.T) {
 					},
 					{
 						Args: [6]SyscallArgument{
-							Any(), {1, false}, Any(), Any(), Any(), Any(),
+							Any(), {Value: 1}, Any(), Any(), Any(), Any(),
 						},
 						Number: 0,
 					},
@@ -66,6 +66,41 @@ func TestFilterElementKeepLeastPreciseMatch(t *testing.T) {
 				},
 			},
 		},
+		{
+			Orig: FilterElement{
+				Match: []SyscallCallFilter{
+					{
+						Args: [6]SyscallArgument{
+							LessThan(5), Any(), Any(), Any(), Any(), Any(),
+						},
+					},
+					{
+						Args: [6]SyscallArgument{
+							GreaterThan(2), Any(), Any(), Any(), Any(), Any(),
+						},
+					},
+					{
+						Args: [6]SyscallArgument{
+							Equal(3), Any(), Any(), Any(), Any(), Any(),
+						},
+					},
+				},
+			},
+			Expected: FilterElement{
+				Match: []SyscallCallFilter{
+					{
+						Args: [6]SyscallArgument{
+							LessThan(5), Any(), Any(), Any(), Any(), Any(),
+						},
+					},
+					{
+						Args: [6]SyscallArgument{
+							GreaterThan(2), Any(), Any(), Any(), Any(), Any(),
+						},
+					},
+				},
+			},
+		},
 	}
 	for i, tc := range cases {
 		tc.Orig.keepLeastPreciseMatch()
@@ -3,8 +3,15 @@
 package goseccomp
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/diconico07/goseccomp/lowlevel"
@@ -161,7 +168,7 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 1,
 								Args: [6]SyscallArgument{
-									{0, false},
+									{Value: 0},
 									Any(),
 									Any(),
 									Any(),
@@ -199,8 +206,8 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 1,
 								Args: [6]SyscallArgument{
-									{0, false},
-									{1, false},
+									{Value: 0},
+									{Value: 1},
 									Any(),
 									Any(),
 									Any(),
@@ -226,7 +233,7 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 3,
 								Args: [6]SyscallArgument{
-									{0, false},
+									{Value: 0},
 									Any(),
 									Any(),
 									Any(),
@@ -262,8 +269,8 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 1,
 								Args: [6]SyscallArgument{
-									{0, false},
-									{1, false},
+									{Value: 0},
+									{Value: 1},
 									Any(),
 									Any(),
 									Any(),
@@ -278,7 +285,7 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 1,
 								Args: [6]SyscallArgument{
-									{0, false},
+									{Value: 0},
 									Any(),
 									Any(),
 									Any(),
@@ -305,7 +312,7 @@ func TestFilterSplitOrderElement(t *testing.T) {
 							{
 								Number: 3,
 								Args: [6]SyscallArgument{
-									{0, false},
+									{Value: 0},
 									Any(),
 									Any(),
 									Any(),
@@ -423,6 +430,95 @@ func TestFilterOptimize(t *testing.T) {
 				},
 			},
 		},
+		{
+			// More precise rules are moved before the less precise ones, but not
+			// past partially overlapping rules taking another decision
+			Orig: Filter{Elements: []FilterElement{
+				{
+					Decision: Decision{Type: Errno, Data: 1},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{LessThan(10), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 2},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{GreaterThan(5), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 3},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{Equal(7), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+			}},
+			Expected: Filter{Elements: []FilterElement{
+				{
+					Decision: Decision{Type: Errno, Data: 1},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{LessThan(10), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{Decision: Decision{Type: Errno, Data: 2}},
+				{
+					Decision: Decision{Type: Errno, Data: 3},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{Equal(7), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 2},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{GreaterThan(5), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+			}},
+		},
+		{
+			// A rule can't be moved past a less precise one taking another decision
+			Orig: Filter{Elements: []FilterElement{
+				{
+					Decision: Decision{Type: Errno, Data: 1},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{MaskedEqual(0xf0, 0x10), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 2},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{LessThan(0x20), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 3},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{Equal(0x15), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+			}},
+			Expected: Filter{Elements: []FilterElement{
+				{
+					Decision: Decision{Type: Errno, Data: 1},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{MaskedEqual(0xf0, 0x10), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{Decision: Decision{Type: Errno, Data: 2}},
+				{
+					Decision: Decision{Type: Errno, Data: 3},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{Equal(0x15), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: 2},
+					Match: []SyscallCallFilter{
+						{Number: 1, Args: [6]SyscallArgument{LessThan(0x20), Any(), Any(), Any(), Any(), Any()}},
+					},
+				},
+			}},
+		},
 	}
 	for i, tc := range cases {
 		tc.Orig.Optimize()
@@ -437,6 +533,35 @@ func TestFilterOptimize(t *testing.T) {
 	}
 }
 
+func TestFilterOptimizeKeepsOverlappingDecisions(t *testing.T) {
+	rule := func(arg SyscallArgument, errno uint16) FilterElement {
+		return FilterElement{
+			Match:    []SyscallCallFilter{{Number: 1, Args: [6]SyscallArgument{arg, Any(), Any(), Any(), Any(), Any()}}},
+			Decision: Decision{Type: Errno, Data: errno},
+		}
+	}
+	// LessThan(10) can't be moved after Equal(7) as GreaterThan(5) lies in between
+	orig := Filter{
+		Architecture:    "amd64",
+		DefaultDecision: Decision{Type: Allow},
+		Elements: []FilterElement{
+			rule(LessThan(10), 1),
+			rule(GreaterThan(5), 2),
+			rule(Equal(7), 3),
+		},
+	}
+	optimized := orig.clone()
+	optimized.Optimize()
+	for arg := uint64(0); arg < 12; arg++ {
+		data := lowlevel.SeccompData{Number: 1, Arch: lowlevel.GetAuditArch("amd64"), Arg0: arg}
+		expected, _ := orig.Explain(data)
+		got, _ := optimized.Explain(data)
+		if got.Decision != expected.Decision {
+			t.Errorf("Argument %d: Expected '%+v' got '%+v'", arg, expected.Decision, got.Decision)
+		}
+	}
+}
+
 func assembleNoError(in []bpf.Instruction) []bpf.RawInstruction {
 	asm, _ := bpf.Assemble(in)
 	return asm
@@ -447,6 +572,58 @@ type TestCaseFilterCompile struct {
 	Instructions []bpf.RawInstruction
 }
 
+func TestFilterCompileSkippedSyscall(t *testing.T) {
+	// A tracer skipping a syscall runs the filter again with the number -1,
+	// which has the x32 bit set but isn't an x32 syscall
+	data := lowlevel.SeccompData{Number: -1, Arch: lowlevel.GetAuditArch("amd64")}
+	for _, policy := range []X32Policy{X32Deny, X32Native, X32Rules} {
+		filter := Filter{
+			Architecture:    "amd64",
+			X32Policy:       policy,
+			DefaultDecision: Decision{Type: Trace},
+		}
+		program, err := filter.Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Evaluate(program, data, "amd64")
+		if err != nil || got != filter.DefaultDecision {
+			t.Errorf("x32 policy %d: Expected '%+v' got '%+v' (%v)", policy, filter.DefaultDecision, got, err)
+		}
+		explanation, err := filter.Explain(data)
+		if err != nil || explanation.Decision != filter.DefaultDecision {
+			t.Errorf("x32 policy %d: Expected the explanation '%+v' got '%+v' (%v)", policy, filter.DefaultDecision, explanation.Decision, err)
+		}
+	}
+}
+
+func TestFilterCompileWideArguments(t *testing.T) {
+	wide := uint64(1) << 32
+	if uint64(uintptr(wide)) != wide {
+		t.Skip("uintptr can't hold 64 bits values")
+	}
+	element := FilterElement{
+		Match: []SyscallCallFilter{
+			{Number: unix.SYS_READ, Args: [6]SyscallArgument{LessThan(uintptr(wide)), Any(), Any(), Any(), Any(), Any()}},
+		},
+		Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+	}
+	cases := []Filter{
+		{Architecture: "arm", Elements: []FilterElement{element}},
+		{Architecture: "amd64", SecondaryArchitectures: []string{"386"}, Elements: []FilterElement{element}},
+	}
+	for i, filter := range cases {
+		_, err := filter.Compile()
+		if err == nil || !strings.Contains(err.Error(), "doesn't fit in 32 bits") {
+			t.Errorf("[%d/%d] Expected an error for a 64 bits value, got %v", i+1, len(cases), err)
+		}
+	}
+	native := Filter{Architecture: "amd64", Elements: []FilterElement{element}}
+	if _, err := native.Compile(); err != nil {
+		t.Errorf("Unexpected error on amd64: %v", err)
+	}
+}
+
 func TestFilterCompile(t *testing.T) {
 	cases := []TestCaseFilterCompile{
 		{
@@ -480,6 +657,134 @@ func TestFilterCompile(t *testing.T) {
 				bpf.RetConstant{Val: 0},
 			}),
 		},
+		{
+			Filter: Filter{
+				Architecture:           "amd64",
+				SecondaryArchitectures: []string{"386"},
+				Elements: []FilterElement{
+					{
+						Match: []SyscallCallFilter{
+							{Number: 257, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+							{Number: 2, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+							{Number: 262, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+						},
+						Decision: Decision{Type: Errno, Data: 1},
+					},
+				},
+				// No newfstatat on 386, fstatat64 instead
+				ArchElements: map[string][]FilterElement{
+					"386": {
+						{
+							Match: []SyscallCallFilter{
+								{Number: 295, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+								{Number: 5, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+								{Number: 300, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+							},
+							Decision: Decision{Type: Errno, Data: 1},
+						},
+					},
+				},
+				DefaultDecision: Decision{Type: Allow},
+			},
+			Instructions: assembleNoError([]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 1, Val: lowlevel.GetAuditArch("amd64")},
+				bpf.Jump{Skip: 3},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 1, Val: lowlevel.GetAuditArch("386")},
+				bpf.Jump{Skip: 10},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+				// amd64
+				lowlevel.LoadSeccompDataField("Number", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 2, Val: skippedSyscall},
+				bpf.JumpIf{Cond: bpf.JumpBitsSet, SkipFalse: 1, Val: lowlevel.X32_SYSCALL_BIT},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 2, Val: 262},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: 2},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 257},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+				// 386
+				lowlevel.LoadSeccompDataField("Number", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 2, Val: 300},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: 5},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 295},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+			}),
+		},
+		{
+			Filter: Filter{
+				Architecture:    "amd64",
+				BadArchDecision: &Decision{Type: Errno, Data: uint16(unix.ENOSYS)},
+			},
+			Instructions: assembleNoError([]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: lowlevel.GetAuditArch("amd64")},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+				lowlevel.LoadSeccompDataField("Number", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 2, Val: skippedSyscall},
+				bpf.JumpIf{Cond: bpf.JumpBitsSet, SkipFalse: 1, Val: lowlevel.X32_SYSCALL_BIT},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+				bpf.RetConstant{Val: 0},
+			}),
+		},
+		{
+			Filter: Filter{
+				Architecture: "amd64",
+				X32Policy:    X32Native,
+				Elements: []FilterElement{
+					{
+						Match: []SyscallCallFilter{
+							{Number: 13, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+						},
+						Decision: Decision{Type: Errno, Data: 1},
+					},
+				},
+				DefaultDecision: Decision{Type: Allow},
+			},
+			Instructions: assembleNoError([]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: lowlevel.GetAuditArch("amd64")},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+				lowlevel.LoadSeccompDataField("Number", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 4, Val: skippedSyscall},
+				bpf.JumpIf{Cond: bpf.JumpBitsSet, SkipFalse: 3, Val: lowlevel.X32_SYSCALL_BIT},
+				// x32 rt_sigaction
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: lowlevel.X32_SYSCALL_BIT + 512},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 13},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+			}),
+		},
+		{
+			Filter: Filter{
+				Architecture: "amd64",
+				X32Policy:    X32Rules,
+				X32Elements: []FilterElement{
+					{
+						Match: []SyscallCallFilter{
+							{Number: lowlevel.X32_SYSCALL_BIT, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+						},
+						Decision: Decision{Type: Errno, Data: 2},
+					},
+				},
+				DefaultDecision: Decision{Type: Allow},
+			},
+			Instructions: assembleNoError([]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arch", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: lowlevel.GetAuditArch("amd64")},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+				lowlevel.LoadSeccompDataField("Number", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 4, Val: skippedSyscall},
+				bpf.JumpIf{Cond: bpf.JumpBitsSet, SkipFalse: 3, Val: lowlevel.X32_SYSCALL_BIT},
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: lowlevel.X32_SYSCALL_BIT},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 2},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+			}),
+		},
 	}
 	for i, tc := range cases {
 		got, err := tc.Filter.Compile()
@@ -508,6 +813,9 @@ func TestFilterCompileErrors(t *testing.T) {
 				Elements:     []FilterElement{{Decision: Decision{Type: 1}}},
 			},
 		},
+		{
+			Filter: Filter{Architecture: "386", BadArchDecision: &Decision{Type: 1}},
+		},
 	}
 	for _, tc := range cases {
 		_, err := tc.Filter.Compile()
@@ -520,6 +828,78 @@ func TestFilterCompileErrors(t *testing.T) {
 	}
 }
 
+func TestFilterCompileKeepsElements(t *testing.T) {
+	backing := make([]FilterElement, 2)
+	backing[1] = FilterElement{Decision: Decision{Type: Errno, Data: 1}}
+	filter := Filter{
+		Architecture: "amd64",
+		Elements:     backing[:1],
+		X32Policy:    X32Rules,
+		X32Elements:  []FilterElement{{Decision: Decision{Type: Trap}}},
+	}
+	if _, err := filter.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if filter.usesUserNotify() {
+		t.Errorf("Expected no UserNotify decision")
+	}
+	if backing[1].Decision.Type != Errno {
+		t.Errorf("Expected '%+v' got '%+v'", Decision{Type: Errno, Data: 1}, backing[1].Decision)
+	}
+}
+
+func TestFilterCompileArchitecturesErrors(t *testing.T) {
+	cases := []Filter{
+		{Architecture: "unknown"},
+		{Architecture: "amd64", SecondaryArchitectures: []string{"unknown"}},
+		{Architecture: "amd64", SecondaryArchitectures: []string{"386", "386"}},
+		{Architecture: "arm64", SecondaryArchitectures: []string{"arm64"}},
+		{Architecture: "amd64", SecondaryArchitectures: []string{"s390x"}},
+		{Architecture: "amd64", X32Policy: 42},
+		{
+			Architecture:           "amd64",
+			SecondaryArchitectures: []string{"386"},
+			Elements: []FilterElement{
+				{Match: []SyscallCallFilter{{Number: 10000}}},
+			},
+		},
+		// No newfstatat on 386
+		{
+			Architecture:           "amd64",
+			SecondaryArchitectures: []string{"386"},
+			Elements: []FilterElement{
+				{Match: []SyscallCallFilter{{Number: 262}}},
+			},
+		},
+		{
+			Architecture: "amd64",
+			X32Policy:    X32Native,
+			Elements: []FilterElement{
+				// No uselib on x32
+				{Match: []SyscallCallFilter{{Number: 134}}},
+			},
+		},
+		// No newfstatat on s390
+		{
+			Architecture:           "s390x",
+			SecondaryArchitectures: []string{"s390"},
+			Elements: []FilterElement{
+				{Match: []SyscallCallFilter{{Number: 293}}, Decision: Decision{Type: Errno, Data: 1}},
+			},
+			DefaultDecision: Decision{Type: Allow},
+		},
+		{
+			Architecture: "amd64",
+			ArchElements: map[string][]FilterElement{"386": nil},
+		},
+	}
+	for i, filter := range cases {
+		if _, err := filter.Compile(); err == nil {
+			t.Errorf("[%d/%d] Got no error", i+1, len(cases))
+		}
+	}
+}
+
 func TestFilterInsert(t *testing.T) {
 	skipc := make(chan bool, 1)
 	skip := func() {
@@ -533,7 +913,12 @@ func TestFilterInsert(t *testing.T) {
 		runtime.LockOSThread()
 		defer close(skipc)
 
-		filter := Filter{DefaultDecision: Decision{Type: Allow}, Architecture: runtime.GOARCH}
+		// SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV is dropped without listener
+		filter := Filter{
+			DefaultDecision: Decision{Type: Allow},
+			Architecture:    runtime.GOARCH,
+			Flags:           lowlevel.SECCOMP_FILTER_FLAG_LOG | lowlevel.SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV,
+		}
 
 		err := filter.Insert()
 		if err != nil {
@@ -554,3 +939,265 @@ func TestFilterInsert(t *testing.T) {
 		t.SkipNow()
 	}
 }
+
+func TestFilterInsertFlags(t *testing.T) {
+	// The flags are checked before anything is done to the thread
+	filter := Filter{
+		DefaultDecision: Decision{Type: Allow},
+		Architecture:    runtime.GOARCH,
+		Flags:           lowlevel.SECCOMP_FILTER_FLAG_TSYNC,
+	}
+	err := filter.Insert()
+	if err == nil || !strings.Contains(err.Error(), "flags 0x1 can't be set") {
+		t.Errorf("Expected an error for the SECCOMP_FILTER_FLAG_TSYNC flag, got %v", err)
+	}
+}
+
+func TestFilterInsertArguments(t *testing.T) {
+	skipc := make(chan bool, 1)
+	skip := func() {
+		skipc <- true
+		runtime.Goexit()
+	}
+
+	go func() {
+		// This test uses seccomp to modify the calling thread, so run it on its own
+		// throwaway thread and do not unlock it when the goroutine exits.
+		runtime.LockOSThread()
+		defer close(skipc)
+
+		// The high word is only checked on 64 bits architectures, where uintptr
+		// holds the threshold
+		threshold := uint64(0x100000000)
+		if !lowlevel.ArchIs64Bits(runtime.GOARCH) {
+			threshold = 0x10000
+		}
+		filter := Filter{
+			DefaultDecision: Decision{Type: Allow},
+			Architecture:    runtime.GOARCH,
+			Elements: []FilterElement{
+				{
+					Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+					Match: []SyscallCallFilter{
+						{
+							Number: unix.SYS_GETPGID,
+							Args:   [6]SyscallArgument{GreaterThan(uintptr(threshold)), Any(), Any(), Any(), Any(), Any()},
+						},
+						{
+							Number: unix.SYS_GETSID,
+							Args:   [6]SyscallArgument{MaskedEqual(0x4, 0x4), Any(), Any(), Any(), Any(), Any()},
+						},
+					},
+				},
+				{
+					Decision: Decision{Type: Errno, Data: uint16(unix.E2BIG)},
+					Match: []SyscallCallFilter{
+						{
+							Number: unix.SYS_GETPPID,
+							Args:   [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()},
+						},
+					},
+				},
+			},
+		}
+		if err := filter.Insert(); err != nil {
+			t.Logf("Seccomp: %v, skipping test", err)
+			skip()
+		}
+
+		cases := []struct {
+			arg      uintptr
+			expected bool
+		}{
+			{0, false},
+			{unix.SYS_GETPPID, false},
+			{uintptr(threshold), false},
+			{uintptr(threshold + 1), true},
+		}
+		for _, tc := range cases {
+			_, _, errno := unix.Syscall(unix.SYS_GETPGID, tc.arg, 0, 0)
+			if (errno == unix.EPERM) != tc.expected {
+				t.Errorf("getpgid(0x%x): expected denied '%t', got %v", tc.arg, tc.expected, errno)
+			}
+			if errno == unix.E2BIG {
+				t.Errorf("getpgid(0x%x) matched the getppid rule", tc.arg)
+			}
+		}
+		for _, pid := range []uint64{0x4, 0x7, 0x100000004} {
+			if uint64(uintptr(pid)) != pid {
+				continue
+			}
+			_, _, errno := unix.Syscall(unix.SYS_GETSID, uintptr(pid), 0, 0)
+			if errno != unix.EPERM {
+				t.Errorf("getsid(0x%x): expected EPERM, got %v", pid, errno)
+			}
+		}
+		for _, pid := range []uintptr{0, 0x3, 0x8} {
+			_, _, errno := unix.Syscall(unix.SYS_GETSID, pid, 0, 0)
+			if errno == unix.EPERM {
+				t.Errorf("getsid(0x%x): unexpected EPERM", pid)
+			}
+		}
+	}()
+
+	if <-skipc {
+		t.SkipNow()
+	}
+}
+
+// insertAllThreads runs in the TestInsertAllThreadsHelper process and returns
+// "ok", "skip: <reason>" or the failure. If diverged is set, a thread gets a
+// filter of its own first, so it can't be synchronized.
+func insertAllThreads(listener bool, diverged bool) string {
+	filter := Filter{
+		DefaultDecision: Decision{Type: Allow},
+		Architecture:    runtime.GOARCH,
+		Elements: []FilterElement{
+			{
+				Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+				Match: []SyscallCallFilter{
+					{
+						Number: unix.SYS_GETPGID,
+						Args:   [6]SyscallArgument{GreaterThan(0x10), Any(), Any(), Any(), Any(), Any()},
+					},
+				},
+			},
+		},
+	}
+	insert := filter.InsertAllThreads
+	if listener {
+		filter.Elements = append(filter.Elements, FilterElement{
+			Decision: Decision{Type: UserNotify},
+			Match:    []SyscallCallFilter{{Number: unix.SYS_GETPPID, Args: anyArgs()}},
+		})
+		insert = func() error { return closeListener(filter.InsertAllThreadsWithListener()) }
+	}
+
+	// Threads started before the insertion get filtered too
+	tids := make(chan [2]int)
+	results := make(chan string)
+	start := make(chan bool)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			if diverged && i == 0 {
+				own := Filter{DefaultDecision: Decision{Type: Allow}, Architecture: runtime.GOARCH}
+				if err := own.Insert(); err != nil {
+					tids <- [2]int{i, -1}
+					return
+				}
+			}
+			tids <- [2]int{i, unix.Gettid()}
+			<-start
+			nnp, err := unix.PrctlRetInt(unix.PR_GET_NO_NEW_PRIVS, 0, 0, 0, 0)
+			if err != nil || nnp != 1 {
+				results <- fmt.Sprintf("thread %d: expected NoNewPrivs, got %d (%v)", unix.Gettid(), nnp, err)
+				return
+			}
+			if _, _, errno := unix.Syscall(unix.SYS_GETPGID, 0x20, 0, 0); errno != unix.EPERM {
+				results <- fmt.Sprintf("thread %d: expected EPERM, got %v", unix.Gettid(), errno)
+				return
+			}
+			results <- "ok"
+		}(i)
+	}
+	var divergedTid int
+	for i := 0; i < 3; i++ {
+		tid := <-tids
+		if tid[1] < 0 {
+			return "skip: seccomp unavailable"
+		}
+		if tid[0] == 0 {
+			divergedTid = tid[1]
+		}
+	}
+
+	err := insert()
+	if listener && errors.Is(err, unix.EINVAL) {
+		return "skip: SECCOMP_FILTER_FLAG_TSYNC_ESRCH unavailable"
+	}
+	if diverged {
+		expected := divergedTid
+		if listener {
+			expected = 0
+		}
+		var syncErr *ThreadSyncError
+		if !errors.As(err, &syncErr) || syncErr.Tid != expected {
+			return fmt.Sprintf("expected a sync error for thread %d, got %v", expected, err)
+		}
+		return "ok"
+	}
+	if err != nil {
+		return fmt.Sprintf("unexpected error: %v", err)
+	}
+	close(start)
+	for i := 0; i < 3; i++ {
+		if result := <-results; result != "ok" {
+			return result
+		}
+	}
+	return "ok"
+}
+
+// TestInsertAllThreadsHelper is run by TestFilterInsertAllThreads in a child
+// process, as it filters all the threads of the process.
+func TestInsertAllThreadsHelper(t *testing.T) {
+	mode := os.Getenv("GOSECCOMP_INSERT_ALL_THREADS_HELPER")
+	if mode == "" {
+		return
+	}
+	fmt.Println(insertAllThreads(strings.Contains(mode, "listener"), strings.Contains(mode, "diverged")))
+}
+
+// unprivilegedHelper returns the test binary and the credentials running it
+// as an unprivileged user, nil if the tests already are unprivileged.
+func unprivilegedHelper(t *testing.T) (string, *syscall.SysProcAttr) {
+	if os.Geteuid() != 0 {
+		return os.Args[0], nil
+	}
+	// The test binary directory is only readable by root
+	dir, err := os.MkdirTemp("", "goseccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "goseccomp.test")
+	if err := os.WriteFile(path, binary, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+}
+
+func TestFilterInsertAllThreads(t *testing.T) {
+	modes := []string{"plain", "listener", "diverged", "diverged listener", "unprivileged", "unprivileged listener"}
+	// Without CAP_SYS_ADMIN, the insertion needs NoNewPrivs on the calling thread
+	unprivileged, credentials := unprivilegedHelper(t)
+	for i, mode := range modes {
+		helper := exec.Command(os.Args[0], "-test.run=^TestInsertAllThreadsHelper$")
+		if strings.Contains(mode, "unprivileged") {
+			helper.Path = unprivileged
+			helper.SysProcAttr = credentials
+		}
+		helper.Env = append(os.Environ(), "GOSECCOMP_INSERT_ALL_THREADS_HELPER="+mode)
+		output, err := helper.Output()
+		if err != nil {
+			t.Fatalf("[%d/%d] Helper failed: %v", i+1, len(modes), err)
+		}
+		result := strings.SplitN(string(output), "\n", 2)[0]
+		switch {
+		case result == "ok":
+		case strings.HasPrefix(result, "skip: "):
+			t.Logf("[%d/%d] %s, skipping", i+1, len(modes), strings.TrimPrefix(result, "skip: "))
+		default:
+			t.Errorf("[%d/%d] %s: %s", i+1, len(modes), mode, result)
+		}
+	}
+}
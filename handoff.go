@@ -0,0 +1,128 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxListenerInfoSize bounds the size of the serialized ListenerInfo
+const maxListenerInfoSize = 4096
+
+// ListenerInfo is the metadata sent along a Listener handed over to a
+// supervisor process.
+type ListenerInfo struct {
+	// Pid is the pid of the process that inserted the filter
+	Pid int `json:"pid"`
+	// FilterID is a free form identifier of the filter the Listener belongs to
+	FilterID string `json:"filterId,omitempty"`
+}
+
+// checkMessageSocket checks that the unix socket keeps the message boundaries,
+// so that a ListenerInfo is read at once along with its file descriptor.
+func checkMessageSocket(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var socketType int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		socketType, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TYPE)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return sockErr
+	}
+	if socketType != unix.SOCK_SEQPACKET && socketType != unix.SOCK_DGRAM {
+		return fmt.Errorf("listener handoff needs a SOCK_SEQPACKET or SOCK_DGRAM socket, got type %d", socketType)
+	}
+	return nil
+}
+
+// SendListener sends the Listener file descriptor along with info over the
+// given unix socket using SCM_RIGHTS. The Listener remains owned by the caller,
+// that usually closes it once sent.
+//
+// The socket must be of the SOCK_SEQPACKET or SOCK_DGRAM type, which keep the
+// message boundaries, stream sockets are refused.
+func SendListener(conn *net.UnixConn, l *Listener, info ListenerInfo) error {
+	fd := l.Fd()
+	if fd < 0 {
+		return os.ErrClosed
+	}
+	if err := checkMessageSocket(conn); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxListenerInfoSize {
+		return fmt.Errorf("listener info too large (%d bytes)", len(payload))
+	}
+	_, _, err = conn.WriteMsgUnix(payload, unix.UnixRights(fd), nil)
+	return err
+}
+
+// ReceiveListener receives a Listener sent with [SendListener] over the given
+// unix socket, which must be of the SOCK_SEQPACKET or SOCK_DGRAM type as with
+// SendListener. The returned Listener is owned by the caller.
+func ReceiveListener(conn *net.UnixConn) (*Listener, ListenerInfo, error) {
+	var info ListenerInfo
+	if err := checkMessageSocket(conn); err != nil {
+		return nil, info, err
+	}
+	payload := make([]byte, maxListenerInfoSize)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(payload, oob)
+	if err != nil {
+		return nil, info, err
+	}
+	fds, err := parseRights(oob[:oobn])
+	if err != nil {
+		return nil, info, err
+	}
+	closeAll := func() {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+	}
+	if flags&(unix.MSG_TRUNC|unix.MSG_CTRUNC) != 0 {
+		closeAll()
+		return nil, info, fmt.Errorf("truncated listener message")
+	}
+	if len(fds) != 1 {
+		closeAll()
+		return nil, info, fmt.Errorf("expected 1 file descriptor, got %d", len(fds))
+	}
+	if err := json.Unmarshal(payload[:n], &info); err != nil {
+		closeAll()
+		return nil, info, fmt.Errorf("invalid listener info: %w", err)
+	}
+	unix.CloseOnExec(fds[0])
+	return NewListener(fds[0]), info, nil
+}
+
+func parseRights(oob []byte) ([]int, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for i := range msgs {
+		rights, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
@@ -0,0 +1,114 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func unixConnPair(t *testing.T, socketType int) (*net.UnixConn, *net.UnixConn) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, socketType|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("socketpair: %v", err)
+	}
+	var conns [2]*net.UnixConn
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "socketpair")
+		conn, err := net.FileConn(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("FileConn: %v", err)
+		}
+		conns[i] = conn.(*net.UnixConn)
+	}
+	return conns[0], conns[1]
+}
+
+func TestListenerHandoff(t *testing.T) {
+	done := make(chan struct{})
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_GETPPID), func() {
+		defer close(done)
+		ret, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+		if errno != 0 || ret != 7 {
+			t.Errorf("expected getppid to return 7, got %d (%v)", ret, errno)
+		}
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+
+	sender, receiver := unixConnPair(t, unix.SOCK_SEQPACKET)
+	defer sender.Close()
+	defer receiver.Close()
+
+	info := ListenerInfo{Pid: os.Getpid(), FilterID: "getppid"}
+	if err := SendListener(sender, listener, info); err != nil {
+		t.Fatalf("failed to send listener: %v", err)
+	}
+	listener.Close()
+
+	received, gotInfo, err := ReceiveListener(receiver)
+	if err != nil {
+		t.Fatalf("failed to receive listener: %v", err)
+	}
+	defer received.Close()
+	if gotInfo != info {
+		t.Errorf("expected info %+v, got %+v", info, gotInfo)
+	}
+	flags, err := unix.FcntlInt(uintptr(received.Fd()), unix.F_GETFD, 0)
+	if err != nil || flags&unix.FD_CLOEXEC == 0 {
+		t.Errorf("received listener should be close-on-exec (flags %d, %v)", flags, err)
+	}
+
+	supervisor := NewSupervisor(received)
+	supervisor.Handle(runtime.GOARCH, unix.SYS_GETPPID, func(ctx context.Context, n *Notification) Response {
+		return ReturnValue(7)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	supervisor.Run(ctx)
+}
+
+func TestReceiveListenerWithoutFd(t *testing.T) {
+	sender, receiver := unixConnPair(t, unix.SOCK_SEQPACKET)
+	defer sender.Close()
+	defer receiver.Close()
+
+	if _, err := sender.Write([]byte(`{"pid":1}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := ReceiveListener(receiver); err == nil {
+		t.Error("expected an error without file descriptor")
+	}
+}
+
+func TestListenerHandoffStream(t *testing.T) {
+	sender, receiver := unixConnPair(t, unix.SOCK_STREAM)
+	defer sender.Close()
+	defer receiver.Close()
+
+	fd, err := unix.Open(os.DevNull, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := NewListener(fd)
+	defer listener.Close()
+	if err := SendListener(sender, listener, ListenerInfo{Pid: 1}); err == nil {
+		t.Error("expected an error sending on a stream socket")
+	}
+	if _, _, err := ReceiveListener(receiver); err == nil {
+		t.Error("expected an error receiving on a stream socket")
+	}
+}
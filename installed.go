@@ -0,0 +1,90 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"runtime"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// InstalledFilter is a seccomp filter installed on a thread, as read back by [InstalledFilters]
+type InstalledFilter struct {
+	// Program is the BPF program of the filter
+	Program []bpf.RawInstruction
+	// Log tells if the filter was installed with SECCOMP_FILTER_FLAG_LOG
+	Log bool
+}
+
+// Filter decompiles the Program, see [Decompile].
+func (i InstalledFilter) Filter(arch string) (*Filter, error) {
+	return Decompile(i.Program, arch)
+}
+
+// InstalledFilters returns the seccomp filters stack of the given thread in their
+// installation order, all of them being run on every syscall. It returns no filter
+// if the thread isn't in seccomp filter mode.
+//
+// The thread is briefly stopped with ptrace, so it must belong to another process and
+// not be traced already. Reading filters needs CAP_SYS_ADMIN and the calling process
+// not to be subject to seccomp filtering.
+func InstalledFilters(tid int) ([]InstalledFilter, error) {
+	// The tracer is the thread that attached
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.PtraceSeize(tid); err != nil {
+		return nil, err
+	}
+	if err := unix.PtraceInterrupt(tid); err != nil {
+		unix.PtraceDetach(tid)
+		return nil, err
+	}
+	var status unix.WaitStatus
+	if _, err := unix.Wait4(tid, &status, unix.WALL, nil); err != nil {
+		unix.PtraceDetach(tid)
+		return nil, err
+	}
+	filters, err := readInstalledFilters(tid)
+	// A signal received before the interruption, rather than a ptrace event
+	// stop, is delivered on detach
+	var signal unix.Signal
+	if status.Stopped() && uint32(status)>>16 == 0 {
+		signal = status.StopSignal()
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_DETACH, uintptr(tid), 0, uintptr(signal), 0, 0)
+	if err == nil && errno != 0 {
+		err = errno
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// readInstalledFilters reads the filters of a stopped tracee
+func readInstalledFilters(tid int) ([]InstalledFilter, error) {
+	var filters []InstalledFilter
+	for index := uint(0); ; index++ {
+		program, err := lowlevel.PtraceSeccompGetFilter(tid, index)
+		if err == unix.ENOENT {
+			return filters, nil
+		}
+		if err == unix.EINVAL && index == 0 {
+			// The thread isn't in seccomp filter mode
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := lowlevel.PtraceSeccompGetMetadata(tid, index)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, InstalledFilter{
+			Program: program,
+			Log:     metadata.Flags&lowlevel.SECCOMP_FILTER_FLAG_LOG != 0,
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+// installedTestFilters are installed by the helper process, the last one with
+// SECCOMP_FILTER_FLAG_LOG
+func installedTestFilters() []Filter {
+	getpgid := FilterElement{
+		Match: []SyscallCallFilter{
+			{Number: unix.SYS_GETPGID, Args: [6]SyscallArgument{GreaterThan(0x10), Any(), Any(), Any(), Any(), Any()}},
+		},
+		Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+	}
+	getsid := FilterElement{
+		Match:    []SyscallCallFilter{{Number: unix.SYS_GETSID, Args: anyArgs()}},
+		Decision: Decision{Type: Errno, Data: uint16(unix.ENOSYS)},
+	}
+	return []Filter{
+		{Architecture: runtime.GOARCH, Elements: []FilterElement{getpgid}, DefaultDecision: Decision{Type: Allow}},
+		{Architecture: runtime.GOARCH, Elements: []FilterElement{getsid}, DefaultDecision: Decision{Type: Allow}},
+	}
+}
+
+// TestInstalledFiltersHelper is run by TestInstalledFilters in a child process,
+// it installs the filters on a thread, writes its tid and waits for stdin to be closed.
+func TestInstalledFiltersHelper(t *testing.T) {
+	if os.Getenv("GOSECCOMP_INSTALLED_FILTERS_HELPER") != "1" {
+		return
+	}
+	runtime.LockOSThread()
+	filters := installedTestFilters()
+	err := filters[0].Insert()
+	if err == nil {
+		_, err = filters[1].insert(lowlevel.SECCOMP_FILTER_FLAG_LOG)
+	}
+	if err != nil {
+		fmt.Printf("error %v\n", err)
+		return
+	}
+	fmt.Printf("tid %d\n", unix.Gettid())
+	bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+func TestInstalledFilters(t *testing.T) {
+	helper := exec.Command(os.Args[0], "-test.run=^TestInstalledFiltersHelper$")
+	helper.Env = append(os.Environ(), "GOSECCOMP_INSTALLED_FILTERS_HELPER=1")
+	stdin, err := helper.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := helper.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer helper.Wait()
+	defer stdin.Close()
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "tid ") {
+		t.Skipf("Seccomp: %s, skipping test", strings.TrimSpace(line))
+	}
+	tid, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "tid ")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installed, err := InstalledFilters(tid)
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) {
+		t.Skipf("Ptrace: %v, skipping test", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := installedTestFilters()
+	if len(installed) != len(expected) {
+		t.Fatalf("Expected %d filters got %d", len(expected), len(installed))
+	}
+	for i, filter := range installed {
+		source := expected[i]
+		if filter.Log != (i == 1) {
+			t.Errorf("[%d/%d] Expected log flag %t got %t", i+1, len(installed), i == 1, filter.Log)
+		}
+		decompiled, err := filter.Filter(runtime.GOARCH)
+		if err != nil {
+			t.Errorf("[%d/%d] Unexpected error: %v", i+1, len(installed), err)
+			continue
+		}
+		difference, err := source.Equivalent(decompiled)
+		if err != nil || difference != nil {
+			t.Errorf("[%d/%d] Expected equivalent filters, got %+v (%v)", i+1, len(installed), difference, err)
+		}
+	}
+}
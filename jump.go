@@ -0,0 +1,134 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/net/bpf"
+)
+
+// longJumpIf is a conditional jump which skips don't fit in a [bpf.JumpIf],
+// relaxJumps turns it into a conditional jump to unconditional ones.
+type longJumpIf struct {
+	Cond      bpf.JumpTest
+	SkipTrue  uint
+	SkipFalse uint
+	Val       uint32
+}
+
+// Assemble implements the bpf.Instruction interface, a longJumpIf can't be
+// assembled and needs to go through relaxJumps first.
+func (j longJumpIf) Assemble() (bpf.RawInstruction, error) {
+	return bpf.RawInstruction{}, fmt.Errorf(
+		"conditional jump too far (%d/%d instructions)",
+		j.SkipTrue, j.SkipFalse,
+	)
+}
+
+// jumpIf returns a [bpf.JumpIf], or a longJumpIf if the skips are too long.
+func jumpIf(cond bpf.JumpTest, skipTrue uint, skipFalse uint, val uint32) bpf.Instruction {
+	if skipTrue > math.MaxUint8 || skipFalse > math.MaxUint8 {
+		return longJumpIf{Cond: cond, SkipTrue: skipTrue, SkipFalse: skipFalse, Val: val}
+	}
+	return bpf.JumpIf{Cond: cond, SkipTrue: uint8(skipTrue), SkipFalse: uint8(skipFalse), Val: val}
+}
+
+// jumpTargets returns the absolute targets of a jump instruction at the given
+// position, nil for other instructions.
+func jumpTargets(instruction bpf.Instruction, position int) []int {
+	switch instruction := instruction.(type) {
+	case bpf.Jump:
+		return []int{position + 1 + int(instruction.Skip)}
+	case bpf.JumpIf:
+		return []int{
+			position + 1 + int(instruction.SkipTrue),
+			position + 1 + int(instruction.SkipFalse),
+		}
+	case longJumpIf:
+		return []int{
+			position + 1 + int(instruction.SkipTrue),
+			position + 1 + int(instruction.SkipFalse),
+		}
+	default:
+		return nil
+	}
+}
+
+// relaxJumps rewrites the conditional jumps too far away for their 8 bits skips
+// so that they jump to trampolines, unconditional jumps with 32 bits skips,
+// placed right after them. Other jumps are adjusted accordingly.
+func relaxJumps(instructions []bpf.Instruction) ([]bpf.Instruction, error) {
+	targets := make([][]int, len(instructions))
+	for i, instruction := range instructions {
+		targets[i] = jumpTargets(instruction, i)
+		for _, target := range targets[i] {
+			if target >= len(instructions) {
+				return nil, fmt.Errorf("instruction %d jumps out of the program", i)
+			}
+		}
+	}
+
+	// Trampolines only make the program grow, so mark the far jumps
+	// until all the others are close enough.
+	trampolines := make([][2]bool, len(instructions))
+	positions := make([]int, len(instructions)+1)
+	for changed := true; changed; {
+		changed = false
+		for i := range instructions {
+			positions[i+1] = positions[i] + 1
+			for _, far := range trampolines[i] {
+				if far {
+					positions[i+1]++
+				}
+			}
+		}
+		for i := range instructions {
+			if _, ok := instructions[i].(bpf.Jump); ok {
+				continue
+			}
+			for branch, target := range targets[i] {
+				if !trampolines[i][branch] && positions[target]-positions[i]-1 > math.MaxUint8 {
+					trampolines[i][branch] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	relaxed := make([]bpf.Instruction, 0, positions[len(instructions)])
+	for i, instruction := range instructions {
+		var cond bpf.JumpTest
+		var val uint32
+		switch instruction := instruction.(type) {
+		case bpf.Jump:
+			relaxed = append(relaxed, bpf.Jump{Skip: uint32(positions[targets[i][0]] - positions[i] - 1)})
+			continue
+		case bpf.JumpIf:
+			cond, val = instruction.Cond, instruction.Val
+		case longJumpIf:
+			cond, val = instruction.Cond, instruction.Val
+		default:
+			relaxed = append(relaxed, instruction)
+			continue
+		}
+		var skips [2]uint8
+		var jumps []bpf.Instruction
+		for branch, target := range targets[i] {
+			if !trampolines[i][branch] {
+				skips[branch] = uint8(positions[target] - positions[i] - 1)
+				continue
+			}
+			skips[branch] = uint8(len(jumps))
+			trampoline := positions[i] + 1 + len(jumps)
+			jumps = append(jumps, bpf.Jump{Skip: uint32(positions[target] - trampoline - 1)})
+		}
+		relaxed = append(
+			relaxed,
+			bpf.JumpIf{Cond: cond, SkipTrue: skips[0], SkipFalse: skips[1], Val: val},
+		)
+		relaxed = append(relaxed, jumps...)
+	}
+	return relaxed, nil
+}
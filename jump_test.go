@@ -0,0 +1,108 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+// padding returns count instructions without any effect
+func padding(count int) []bpf.Instruction {
+	instructions := make([]bpf.Instruction, count)
+	for i := range instructions {
+		instructions[i] = bpf.TAX{}
+	}
+	return instructions
+}
+
+type TestCasesRelaxJumps struct {
+	program  []bpf.Instruction
+	expected []bpf.Instruction
+}
+
+func TestRelaxJumps(t *testing.T) {
+	build := func(parts ...[]bpf.Instruction) []bpf.Instruction {
+		var instructions []bpf.Instruction
+		for _, part := range parts {
+			instructions = append(instructions, part...)
+		}
+		return instructions
+	}
+	cases := []TestCasesRelaxJumps{
+		{
+			build(
+				[]bpf.Instruction{jumpIf(bpf.JumpEqual, 1, 0, 1)},
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}, bpf.RetConstant{Val: 2}},
+			),
+			build(
+				[]bpf.Instruction{bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1, Val: 1}},
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}, bpf.RetConstant{Val: 2}},
+			),
+		},
+		{
+			build(
+				[]bpf.Instruction{jumpIf(bpf.JumpEqual, 300, 0, 1)},
+				padding(300),
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}},
+			),
+			build(
+				[]bpf.Instruction{
+					bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 1},
+					bpf.Jump{Skip: 300},
+				},
+				padding(300),
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}},
+			),
+		},
+		{
+			// The first jump becomes too far because of the second one trampolines
+			build(
+				[]bpf.Instruction{
+					jumpIf(bpf.JumpEqual, 255, 0, 1),
+					jumpIf(bpf.JumpGreaterThan, 300, 280, 2),
+				},
+				padding(300),
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}},
+			),
+			build(
+				[]bpf.Instruction{
+					bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 1},
+					bpf.Jump{Skip: 257},
+					bpf.JumpIf{Cond: bpf.JumpGreaterThan, SkipTrue: 0, SkipFalse: 1, Val: 2},
+					bpf.Jump{Skip: 301},
+					bpf.Jump{Skip: 280},
+				},
+				padding(300),
+				[]bpf.Instruction{bpf.RetConstant{Val: 1}},
+			),
+		},
+	}
+	for i, tc := range cases {
+		got, err := relaxJumps(tc.program)
+		if err != nil {
+			t.Errorf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("[%d/%d]\n\tExpected: %+v\n\tGot:      %+v", i+1, len(cases), tc.expected, got)
+		}
+	}
+}
+
+func TestRelaxJumpsErrors(t *testing.T) {
+	cases := [][]bpf.Instruction{
+		{bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 1}, bpf.RetConstant{}},
+		{bpf.Jump{Skip: 1}},
+	}
+	for i, program := range cases {
+		if _, err := relaxJumps(program); err == nil {
+			t.Errorf("[%d/%d] Got no error", i+1, len(cases))
+		}
+	}
+	if _, err := bpf.Assemble([]bpf.Instruction{jumpIf(bpf.JumpEqual, 256, 0, 1)}); err == nil {
+		t.Error("Expected long jumps to fail assembling")
+	}
+}
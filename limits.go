@@ -0,0 +1,169 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// installedFilterPenalty is the number of instructions the kernel accounts for
+// each installed filter on top of its program, when stacking a new one.
+const installedFilterPenalty = 4
+
+// ElementCost is the number of instructions generated for a FilterElement
+type ElementCost struct {
+	// Index is the index of the element in the Filter Elements, or X32Elements if X32 is set,
+	// or ArchElements of Arch if Arch is set
+	Index int
+	// X32 tells if the element is part of the Filter X32Elements
+	X32 bool
+	// Arch is the architecture of the element if it is part of the Filter ArchElements
+	Arch string
+	// Decision is the decision of the element
+	Decision Decision
+	// Instructions is the number of instructions of the element, for all architectures,
+	// when compiled as linear checks
+	Instructions int
+}
+
+// ProgramTooLargeError is returned when a Filter exceeds the kernel limits on
+// the size of seccomp programs.
+type ProgramTooLargeError struct {
+	// Instructions is the number of instructions of the compiled Filter
+	Instructions int
+	// Installed is the number of instructions accounted for the installed filters
+	// given to [Filter.CompileStacked], penalties included
+	Installed int
+	// Limit is the exceeded limit, either lowlevel.BPF_MAXINSNS or lowlevel.MAX_INSNS_PER_PATH
+	Limit int
+	// Err is the kernel error when inserting the Filter exceeded the
+	// lowlevel.MAX_INSNS_PER_PATH limit, as only [Filter.CompileStacked] checks it
+	// beforehand. The kernel returns ENOMEM for it, as well as for allocation
+	// failures, so the limit might not be the actual cause.
+	Err error
+	// Elements are the costs of the Filter elements, the most expensive first
+	Elements []ElementCost
+}
+
+func (e *ProgramTooLargeError) Error() string {
+	var message strings.Builder
+	if e.Limit == lowlevel.MAX_INSNS_PER_PATH && e.Err == nil {
+		fmt.Fprintf(
+			&message,
+			"seccomp program of %d instructions exceeds the limit of %d instructions with the installed filters (%d instructions)",
+			e.Instructions, e.Limit, e.Installed,
+		)
+	} else if e.Limit == lowlevel.MAX_INSNS_PER_PATH {
+		fmt.Fprintf(
+			&message,
+			"seccomp program of %d instructions refused, the filters of the thread may exceed the limit of %d instructions: %v",
+			e.Instructions, e.Limit, e.Err,
+		)
+	} else {
+		fmt.Fprintf(
+			&message,
+			"seccomp program of %d instructions exceeds the limit of %d instructions",
+			e.Instructions, e.Limit,
+		)
+	}
+	for i, element := range e.Elements {
+		if i == 3 {
+			break
+		}
+		if i == 0 {
+			message.WriteString(", largest elements:")
+		} else {
+			message.WriteString(",")
+		}
+		elements := "Elements"
+		if element.X32 {
+			elements = "X32Elements"
+		} else if element.Arch != "" {
+			elements = fmt.Sprintf("ArchElements[%q]", element.Arch)
+		}
+		fmt.Fprintf(&message, " %s[%d] (%d instructions)", elements, element.Index, element.Instructions)
+	}
+	return message.String()
+}
+
+func (e *ProgramTooLargeError) Unwrap() error { return e.Err }
+
+// CompileStacked behaves like [Filter.Compile] and also checks the program can be
+// stacked on the installed filters of a thread, as returned by [InstalledFilters].
+//
+// The kernel accounts for each installed filter its instructions plus 4, and
+// refuses a new program when the total with its own instructions exceeds
+// lowlevel.MAX_INSNS_PER_PATH, which is 256KiB of 8 bytes instructions.
+func (f *Filter) CompileStacked(installed []InstalledFilter) ([]bpf.RawInstruction, error) {
+	program, err := f.Compile()
+	if err != nil {
+		return nil, err
+	}
+	accounted := 0
+	for _, filter := range installed {
+		accounted += len(filter.Program) + installedFilterPenalty
+	}
+	if accounted+len(program) > lowlevel.MAX_INSNS_PER_PATH {
+		return nil, &ProgramTooLargeError{
+			Instructions: len(program),
+			Installed:    accounted,
+			Limit:        lowlevel.MAX_INSNS_PER_PATH,
+			Elements:     f.elementCosts(),
+		}
+	}
+	return program, nil
+}
+
+// elementCosts returns the costs of the Filter elements, the most expensive first
+func (f *Filter) elementCosts() []ElementCost {
+	var costs []ElementCost
+	archs := append([]string{f.Architecture}, f.SecondaryArchitectures...)
+	for i, element := range f.Elements {
+		costs = append(costs, ElementCost{Index: i, Decision: element.Decision})
+	}
+	for _, arch := range archs {
+		numbering := []string{arch}
+		if arch == "amd64" && f.X32Policy == X32Native {
+			numbering = append(numbering, "x32")
+		}
+		for _, table := range numbering {
+			if elements, ok := f.ArchElements[table]; ok && table != f.Architecture && table != "x32" {
+				for i, element := range elements {
+					costs = append(costs, ElementCost{
+						Index:        i,
+						Arch:         table,
+						Decision:     element.Decision,
+						Instructions: len(element.compile(arch)),
+					})
+				}
+				continue
+			}
+			elements, err := f.elementsFor(table)
+			if err != nil {
+				continue
+			}
+			for i, element := range elements {
+				costs[i].Instructions += len(element.compile(arch))
+			}
+		}
+		if arch == "amd64" && f.X32Policy == X32Rules {
+			for i, element := range f.X32Elements {
+				costs = append(costs, ElementCost{
+					Index:        i,
+					X32:          true,
+					Decision:     element.Decision,
+					Instructions: len(element.compile(arch)),
+				})
+			}
+		}
+	}
+	sort.SliceStable(costs, func(i, j int) bool {
+		return costs[i].Instructions > costs[j].Instructions
+	})
+	return costs
+}
@@ -0,0 +1,133 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func largeFilter() Filter {
+	small := FilterElement{
+		Match:    []SyscallCallFilter{{Number: 0, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}}},
+		Decision: Decision{Type: Allow},
+	}
+	large := FilterElement{Decision: Decision{Type: Errno, Data: 1}}
+	for number := uint(1); number < 1000; number++ {
+		large.Match = append(large.Match, SyscallCallFilter{
+			Number: number,
+			Args:   [6]SyscallArgument{Equal(uintptr(number)), Any(), Any(), Any(), Any(), Any()},
+		})
+	}
+	return Filter{
+		Architecture:    "amd64",
+		Elements:        []FilterElement{small, large},
+		DefaultDecision: Decision{Type: KillProcess},
+	}
+}
+
+func TestFilterCompileTooLarge(t *testing.T) {
+	filter := largeFilter()
+	_, err := filter.Compile()
+	var tooLarge *ProgramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a ProgramTooLargeError, got %v", err)
+	}
+	if tooLarge.Limit != lowlevel.BPF_MAXINSNS || tooLarge.Instructions <= lowlevel.BPF_MAXINSNS {
+		t.Errorf("Unexpected limits in %+v", tooLarge)
+	}
+	if len(tooLarge.Elements) != 2 || tooLarge.Elements[0].Index != 1 || tooLarge.Elements[1].Index != 0 {
+		t.Errorf("Expected the largest element first, got %+v", tooLarge.Elements)
+	}
+	if !strings.Contains(err.Error(), "Elements[1]") {
+		t.Errorf("Expected the error to name the largest element: %v", err)
+	}
+}
+
+func TestFilterCompileTooLargeArchElements(t *testing.T) {
+	filter := largeFilter()
+	filter.SecondaryArchitectures = []string{"386"}
+	filter.ArchElements = map[string][]FilterElement{"386": filter.Elements[1:]}
+	filter.Elements = filter.Elements[:1]
+	_, err := filter.Compile()
+	var tooLarge *ProgramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a ProgramTooLargeError, got %v", err)
+	}
+	if len(tooLarge.Elements) != 2 || tooLarge.Elements[0].Arch != "386" || tooLarge.Elements[0].Index != 0 {
+		t.Errorf("Expected the 386 element first, got %+v", tooLarge.Elements)
+	}
+	if !strings.Contains(err.Error(), `ArchElements["386"][0]`) {
+		t.Errorf("Expected the error to name the largest element: %v", err)
+	}
+}
+
+func TestFilterCompileStacked(t *testing.T) {
+	filter := Filter{Architecture: "amd64", DefaultDecision: Decision{Type: Allow}}
+	program, err := filter.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := make([]InstalledFilter, 8)
+	for i := range installed {
+		installed[i].Program = make([]bpf.RawInstruction, lowlevel.BPF_MAXINSNS-4)
+	}
+	if _, err := filter.CompileStacked(installed[:7]); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// The 4 instructions per filter penalty leaves no room for the program
+	_, err = filter.CompileStacked(installed)
+	var tooLarge *ProgramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a ProgramTooLargeError, got %v", err)
+	}
+	if tooLarge.Limit != lowlevel.MAX_INSNS_PER_PATH ||
+		tooLarge.Installed != lowlevel.MAX_INSNS_PER_PATH ||
+		tooLarge.Instructions != len(program) {
+		t.Errorf("Unexpected limits in %+v", tooLarge)
+	}
+	if !strings.Contains(err.Error(), "installed filters (32768 instructions)") {
+		t.Errorf("Expected the error to tell the installed instructions: %v", err)
+	}
+}
+
+func TestFilterInsertInstalledLimit(t *testing.T) {
+	filter := Filter{Architecture: runtime.GOARCH, DefaultDecision: Decision{Type: Allow}}
+	element := FilterElement{Decision: Decision{Type: Errno, Data: 1}}
+	for number := uint(1000); number < 1500; number++ {
+		element.Match = append(element.Match, SyscallCallFilter{
+			Number: number,
+			Args:   [6]SyscallArgument{Equal(uintptr(number)), Any(), Any(), Any(), Any(), Any()},
+		})
+	}
+	filter.Elements = []FilterElement{element}
+
+	errc := make(chan error, 1)
+	go func() {
+		// Filters can't be removed, run on a throwaway thread and do not unlock
+		// it when the goroutine exits.
+		runtime.LockOSThread()
+		var err error
+		for i := 0; i < 2*lowlevel.MAX_INSNS_PER_PATH/lowlevel.BPF_MAXINSNS && err == nil; i++ {
+			err = filter.Insert()
+		}
+		errc <- err
+	}()
+	err := <-errc
+	if err == unix.EINVAL || err == unix.EACCES {
+		t.Skipf("Insert: %v, skipping test", err)
+	}
+	var tooLarge *ProgramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected a ProgramTooLargeError, got %v", err)
+	}
+	if tooLarge.Limit != lowlevel.MAX_INSNS_PER_PATH || !errors.Is(err, unix.ENOMEM) {
+		t.Errorf("Unexpected limits in %+v", tooLarge)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// Listener owns a seccomp user-space notification file descriptor, as
+// returned by the kernel when a filter using the UserNotify decision gets
+// inserted.
+//
+// Closing the Listener makes all pending and future notifications of the
+// associated filter fail with ENOSYS.
+type Listener struct {
+	mu sync.RWMutex
+	fd int
+}
+
+// NewListener wraps an already opened seccomp notification file descriptor,
+// the returned Listener takes ownership of fd.
+func NewListener(fd int) *Listener {
+	return &Listener{fd: fd}
+}
+
+// Fd returns the underlying file descriptor, or -1 if the Listener is closed.
+// The file descriptor remains owned by the Listener.
+func (l *Listener) Fd() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fd
+}
+
+// File returns a duplicate of the underlying file descriptor as an [os.File],
+// suitable to be handed over to another process (e.g. in [os/exec.Cmd] ExtraFiles).
+// The caller is responsible for closing the returned file.
+func (l *Listener) File() (*os.File, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.fd < 0 {
+		return nil, os.ErrClosed
+	}
+	fd, err := unix.FcntlInt(uintptr(l.fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "seccomp-listener"), nil
+}
+
+// Close releases the underlying file descriptor.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fd < 0 {
+		return os.ErrClosed
+	}
+	err := unix.Close(l.fd)
+	l.fd = -1
+	return err
+}
@@ -0,0 +1,103 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestFilterInsertWithListener(t *testing.T) {
+	skipc := make(chan bool, 1)
+	skip := func() {
+		skipc <- true
+		runtime.Goexit()
+	}
+
+	go func() {
+		// This test uses seccomp to modify the calling thread, so run it on its own
+		// throwaway thread and do not unlock it when the goroutine exits.
+		runtime.LockOSThread()
+		defer close(skipc)
+
+		filter := Filter{
+			DefaultDecision: Decision{Type: Allow},
+			Architecture:    runtime.GOARCH,
+			Elements: []FilterElement{
+				{
+					Decision: Decision{Type: UserNotify},
+					Match: []SyscallCallFilter{
+						{
+							Number: unix.SYS_GETPPID,
+							Args:   [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()},
+						},
+					},
+				},
+			},
+		}
+		listener, err := filter.InsertWithListener()
+		if err != nil {
+			t.Logf("Seccomp: %v, skipping test", err)
+			skip()
+		}
+		if listener == nil || listener.Fd() < 0 {
+			t.Errorf("expected a valid listener, got %+v", listener)
+			return
+		}
+		file, err := listener.File()
+		if err != nil {
+			t.Errorf("failed to duplicate listener: %v", err)
+		} else {
+			file.Close()
+		}
+		if err := listener.Close(); err != nil {
+			t.Errorf("failed to close listener: %v", err)
+		}
+		if err := listener.Close(); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected os.ErrClosed on second close, got %v", err)
+		}
+		if listener.Fd() != -1 {
+			t.Errorf("expected fd -1 after close, got %d", listener.Fd())
+		}
+
+		_, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+		if errno != unix.ENOSYS {
+			t.Errorf("expected ENOSYS without listener, got %v", errno)
+		}
+	}()
+
+	if <-skipc {
+		t.SkipNow()
+	}
+}
+
+func TestFilterInsertWithListenerNoNotify(t *testing.T) {
+	skipc := make(chan bool, 1)
+	skip := func() {
+		skipc <- true
+		runtime.Goexit()
+	}
+
+	go func() {
+		runtime.LockOSThread()
+		defer close(skipc)
+
+		filter := Filter{DefaultDecision: Decision{Type: Allow}, Architecture: runtime.GOARCH}
+		listener, err := filter.InsertWithListener()
+		if err != nil {
+			t.Logf("Seccomp: %v, skipping test", err)
+			skip()
+		}
+		if listener != nil {
+			t.Errorf("expected no listener, got %+v", listener)
+		}
+	}()
+
+	if <-skipc {
+		t.SkipNow()
+	}
+}
@@ -59,6 +59,25 @@ func GetAuditArch(goArch string) uint32 {
 	}
 }
 
+// goArches lists the GOARCH strings known to GetAuditArch
+var goArches = []string{
+	"386", "amd64", "arm", "arm64", "armbe", "arm64be", "loong64",
+	"mips", "mips64", "mips64le", "mips64p32", "mips64p32le", "mipsle",
+	"ppc", "ppc64", "ppc64le", "riscv", "riscv64", "s390", "s390x",
+	"sparc", "sparc64",
+}
+
+// GoArch returns the GOARCH string of an audit architecture, it is
+// the inverse of GetAuditArch. The second value is false if unknown.
+func GoArch(auditArch uint32) (string, bool) {
+	for _, goArch := range goArches {
+		if GetAuditArch(goArch) == auditArch {
+			return goArch, true
+		}
+	}
+	return "", false
+}
+
 // ArchIs64Bits identifies whether the given GOARCH string is
 // considered 64 bits by the linux kernel
 func ArchIs64Bits(goArch string) bool {
@@ -0,0 +1,216 @@
+// SPDX-Licence-Identifier: MIT
+
+//go:build ignore
+
+// mksyscalltables generates zsyscalltables.go from the golang.org/x/sys/unix
+// syscall numbers found in the directory given as first argument, and from the
+// linux uapi headers of the architectures x/sys/unix doesn't know (x32,
+// mips64p32, mips64p32le, riscv, s390 and sparc).
+//
+// The second argument is the directory where these headers are installed, one
+// kernel architecture per subdirectory as given by
+// "make headers_install ARCH=<arch> INSTALL_HDR_PATH=<dir>/<arch>" for the
+// x86, mips, riscv, s390 and sparc kernel architectures. These headers must come
+// from the Linux version given by linuxVersion, which is recorded in the
+// generated file so that it can be reproduced.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// linuxVersion is the Linux release the uapi headers are installed from, bump it
+// when regenerating from newer headers.
+const linuxVersion = "7.0"
+
+var architectures = []string{
+	"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le",
+	"mipsle", "ppc", "ppc64", "ppc64le", "riscv64", "s390x", "sparc64",
+}
+
+// Private ARM syscalls are not part of asm/unistd.h
+var armPrivate = map[string]uint{
+	"breakpoint": 0x0f0001,
+	"cacheflush": 0x0f0002,
+	"usr26":      0x0f0003,
+	"usr32":      0x0f0004,
+	"set_tls":    0x0f0005,
+	"get_tls":    0x0f0006,
+}
+
+// x32SyscallBit is __X32_SYSCALL_BIT, set in the number of all x32 syscalls
+const x32SyscallBit = 0x40000000
+
+var sysnumRe = regexp.MustCompile(`^\s*SYS_([A-Z0-9_]+)\s*=\s*([0-9]+)$`)
+
+// n32Base is __NR_Linux, the first syscall number of the mips n32 ABI
+const n32Base = 6000
+
+var (
+	nrRe  = regexp.MustCompile(`^#define __NR_([a-z0-9_]+)\s+([0-9]+)$`)
+	n32Re = regexp.MustCompile(`^#define __NR_([a-z0-9_]+)\s+\(__NR_Linux \+ ([0-9]+)\)$`)
+	x32Re = regexp.MustCompile(`^#define __NR_([a-z0-9_]+)\s+\(__X32_SYSCALL_BIT \+ ([0-9]+)\)$`)
+)
+
+// tableSource is the file a syscall table is read from, numbers matched by re
+// being offset by base.
+type tableSource struct {
+	arch string
+	path string
+	re   *regexp.Regexp
+	base uint
+}
+
+// uapiHeaders are the headers of the architectures missing from x/sys/unix,
+// relative to the headers directory.
+var uapiHeaders = []tableSource{
+	{"mips64p32", "mips/include/asm/unistd_n32.h", n32Re, n32Base},
+	{"mips64p32le", "mips/include/asm/unistd_n32.h", n32Re, n32Base},
+	{"riscv", "riscv/include/asm/unistd_32.h", nrRe, 0},
+	{"s390", "s390/include/asm/unistd_32.h", nrRe, 0},
+	{"sparc", "sparc/include/asm/unistd_32.h", nrRe, 0},
+	{"x32", "x86/include/asm/unistd_x32.h", x32Re, x32SyscallBit},
+}
+
+var versionRe = regexp.MustCompile(`^#define LINUX_VERSION_(MAJOR|PATCHLEVEL) ([0-9]+)$`)
+
+// checkVersion fails if the headers installed in dir don't come from linuxVersion
+func checkVersion(dir string) error {
+	path := filepath.Join(dir, "include/linux/version.h")
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	version := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := versionRe.FindStringSubmatch(scanner.Text()); match != nil {
+			version[match[1]] = match[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if got := version["MAJOR"] + "." + version["PATCHLEVEL"]; got != linuxVersion {
+		return fmt.Errorf("%s: headers of Linux %s instead of %s", path, got, linuxVersion)
+	}
+	return nil
+}
+
+func readTable(path string, re *regexp.Regexp, base uint) (map[string]uint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	table := make(map[string]uint)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := re.FindStringSubmatch(scanner.Text())
+		// SYS_SYSCALL_MASK and __NR_syscalls aren't syscalls
+		if match == nil || match[1] == "SYSCALL_MASK" || match[1] == "syscalls" {
+			continue
+		}
+		number, err := strconv.ParseUint(match[2], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		table[strings.ToLower(match[1])] = base + uint(number)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table) == 0 {
+		return nil, fmt.Errorf("no syscall found in %s", path)
+	}
+	return table, nil
+}
+
+func writeTable(buf *bytes.Buffer, table map[string]uint) {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if table[names[i]] != table[names[j]] {
+			return table[names[i]] < table[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t%q: %d,\n", name, table[name])
+	}
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: go run mksyscalltables.go <x/sys/unix directory> <uapi headers directory>")
+	}
+	dir, headers := os.Args[1], os.Args[2]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mksyscalltables.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "// Syscall numbers from golang.org/x/sys/unix and the Linux %s uapi headers.\n\n", linuxVersion)
+	fmt.Fprintf(&buf, "package lowlevel\n\n")
+
+	var tables bytes.Buffer
+	seen := make(map[string]string)
+	fmt.Fprintf(&buf, "var syscallTables = map[string]map[string]uint{\n")
+	var sources []tableSource
+	for _, arch := range architectures {
+		sources = append(sources, tableSource{arch, filepath.Join(dir, "zsysnum_linux_"+arch+".go"), sysnumRe, 0})
+	}
+	for _, uapi := range uapiHeaders {
+		kernelArch := strings.SplitN(uapi.path, "/", 2)[0]
+		if err := checkVersion(filepath.Join(headers, kernelArch)); err != nil {
+			log.Fatal(err)
+		}
+		uapi.path = filepath.Join(headers, uapi.path)
+		sources = append(sources, uapi)
+	}
+	for _, source := range sources {
+		arch := source.arch
+		table, err := readTable(source.path, source.re, source.base)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if arch == "arm" {
+			for name, number := range armPrivate {
+				table[name] = number
+			}
+		}
+		var content bytes.Buffer
+		writeTable(&content, table)
+		// Architectures sharing the same numbering share the same table
+		varName, ok := seen[content.String()]
+		if !ok {
+			varName = "syscallTable" + strings.ToUpper(arch[:1]) + arch[1:]
+			seen[content.String()] = varName
+			fmt.Fprintf(&tables, "\nvar %s = map[string]uint{\n", varName)
+			tables.Write(content.Bytes())
+			fmt.Fprintf(&tables, "}\n")
+		}
+		fmt.Fprintf(&buf, "\t%q: %s,\n", arch, varName)
+	}
+	fmt.Fprintf(&buf, "}\n")
+	buf.Write(tables.Bytes())
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("zsyscalltables.go", source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
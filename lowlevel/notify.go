@@ -0,0 +1,196 @@
+// SPDX-Licence-Identifier: MIT
+
+package lowlevel
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Seccomp notification response flag to let the kernel execute the notifying syscall
+	SECCOMP_USER_NOTIF_FLAG_CONTINUE = 1 << 0
+
+	// Seccomp addfd flag to install the file descriptor at the given Newfd number
+	SECCOMP_ADDFD_FLAG_SETFD = 1 << 0
+	// Seccomp addfd flag to atomically install the file descriptor and answer the
+	// notification with the new file descriptor number as return value
+	SECCOMP_ADDFD_FLAG_SEND = 1 << 1
+)
+
+// SeccompNotif mirrors the kernel seccomp_notif structure, describing a
+// syscall waiting for a decision from the user-space supervisor.
+type SeccompNotif struct {
+	// Id is the cookie identifying the notification
+	Id uint64
+	// Pid is the thread id of the notifying thread, in the listener pid namespace
+	Pid uint32
+	// Flags is currently unused and always 0
+	Flags uint32
+	// Data is the seccomp data that triggered the notification
+	Data SeccompData
+}
+
+// SeccompNotifResp mirrors the kernel seccomp_notif_resp structure,
+// the answer to a [SeccompNotif].
+type SeccompNotifResp struct {
+	// Id is the cookie of the notification to answer to
+	Id uint64
+	// Val is the return value of the syscall, used if Error is 0
+	Val int64
+	// Error is the negated errno to return, 0 meaning success
+	Error int32
+	// Flags is a combination of SECCOMP_USER_NOTIF_FLAG_* constants
+	Flags uint32
+}
+
+// SeccompNotifAddfd mirrors the kernel seccomp_notif_addfd structure, used
+// to install a file descriptor into the notifying process.
+type SeccompNotifAddfd struct {
+	// Id is the cookie of the notification the file descriptor is installed for
+	Id uint64
+	// Flags is a combination of SECCOMP_ADDFD_FLAG_* constants
+	Flags uint32
+	// Srcfd is the supervisor file descriptor to install
+	Srcfd uint32
+	// Newfd is the file descriptor number to use with SECCOMP_ADDFD_FLAG_SETFD
+	Newfd uint32
+	// NewfdFlags are the flags to set on the new file descriptor (only O_CLOEXEC is supported)
+	NewfdFlags uint32
+}
+
+// ioctlRequest computes an ioctl request number the same way the _IOC macro does
+// for the running architecture.
+func ioctlRequest(write, read bool, nr uintptr, size uintptr) uint {
+	const seccompIocMagic = '!'
+	sizeBits, dirNone, dirWrite, dirRead := uintptr(14), uintptr(0), uintptr(1), uintptr(2)
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc", "ppc64", "ppc64le", "sparc", "sparc64":
+		sizeBits, dirNone, dirWrite, dirRead = 13, 1, 4, 2
+	}
+	dir := dirNone
+	if write || read {
+		dir = 0
+		if write {
+			dir |= dirWrite
+		}
+		if read {
+			dir |= dirRead
+		}
+	}
+	return uint(dir<<(16+sizeBits) | size<<16 | seccompIocMagic<<8 | nr)
+}
+
+var (
+	// Seccomp notification file descriptor ioctl to receive a notification
+	SECCOMP_IOCTL_NOTIF_RECV = ioctlRequest(true, true, 0, unsafe.Sizeof(SeccompNotif{}))
+	// Seccomp notification file descriptor ioctl to answer a notification
+	SECCOMP_IOCTL_NOTIF_SEND = ioctlRequest(true, true, 1, unsafe.Sizeof(SeccompNotifResp{}))
+	// Seccomp notification file descriptor ioctl to check a notification is still valid
+	SECCOMP_IOCTL_NOTIF_ID_VALID = ioctlRequest(true, false, 2, unsafe.Sizeof(uint64(0)))
+	// Seccomp notification file descriptor ioctl to install a file descriptor in the notifying process
+	SECCOMP_IOCTL_NOTIF_ADDFD = ioctlRequest(true, false, 3, unsafe.Sizeof(SeccompNotifAddfd{}))
+
+	// Legacy (pre 5.7) request number of [SECCOMP_IOCTL_NOTIF_ID_VALID]
+	seccompIoctlNotifIDValidWrongDir = ioctlRequest(false, true, 2, unsafe.Sizeof(uint64(0)))
+)
+
+var notifSizes struct {
+	once  sync.Once
+	sizes SeccompNotifSizes
+	err   error
+}
+
+func cachedNotifSizes() (SeccompNotifSizes, error) {
+	notifSizes.once.Do(func() {
+		notifSizes.sizes, notifSizes.err = SeccompGetNotifSizes()
+	})
+	return notifSizes.sizes, notifSizes.err
+}
+
+// notifBuffer allocates a zeroed, 8 bytes aligned, buffer of at least
+// size and kernelSize bytes.
+func notifBuffer(size uintptr, kernelSize uint16) []uint64 {
+	if uintptr(kernelSize) > size {
+		size = uintptr(kernelSize)
+	}
+	return make([]uint64, (size+7)/8)
+}
+
+func ioctl(fd int, req uint, arg unsafe.Pointer) (int, unix.Errno) {
+	ret, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg))
+	return int(ret), errno
+}
+
+// SeccompIoctlNotifRecv waits for a notification on the given listener file descriptor.
+// The receive buffer is sized according to [SeccompGetNotifSizes] so kernels using
+// larger structures are supported.
+//
+// It returns ENOENT if the notifying thread got killed before the notification was read.
+func SeccompIoctlNotifRecv(fd int) (SeccompNotif, error) {
+	var notif SeccompNotif
+	sizes, err := cachedNotifSizes()
+	if err != nil {
+		return notif, err
+	}
+	buf := notifBuffer(unsafe.Sizeof(notif), sizes.SeccompNotif)
+	for {
+		_, errno := ioctl(fd, SECCOMP_IOCTL_NOTIF_RECV, unsafe.Pointer(&buf[0]))
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return notif, errnoErr(errno)
+		}
+		break
+	}
+	notif = *(*SeccompNotif)(unsafe.Pointer(&buf[0]))
+	return notif, nil
+}
+
+// SeccompIoctlNotifSend answers a notification received on the given listener file descriptor.
+//
+// It returns ENOENT if the notifying thread got killed in the meantime.
+func SeccompIoctlNotifSend(fd int, resp SeccompNotifResp) error {
+	sizes, err := cachedNotifSizes()
+	if err != nil {
+		return err
+	}
+	buf := notifBuffer(unsafe.Sizeof(resp), sizes.SeccompNotifResp)
+	*(*SeccompNotifResp)(unsafe.Pointer(&buf[0])) = resp
+	for {
+		_, errno := ioctl(fd, SECCOMP_IOCTL_NOTIF_SEND, unsafe.Pointer(&buf[0]))
+		if errno == unix.EINTR {
+			continue
+		}
+		return errnoErr(errno)
+	}
+}
+
+// SeccompIoctlNotifIDValid checks that the notification with the given id is still
+// pending, it returns ENOENT if it is not.
+//
+// This shall be used after reading the notifying process memory to guard against
+// the process being replaced by another one with the same pid.
+func SeccompIoctlNotifIDValid(fd int, id uint64) error {
+	_, errno := ioctl(fd, SECCOMP_IOCTL_NOTIF_ID_VALID, unsafe.Pointer(&id))
+	if errno == unix.EINVAL {
+		_, errno = ioctl(fd, seccompIoctlNotifIDValidWrongDir, unsafe.Pointer(&id))
+	}
+	return errnoErr(errno)
+}
+
+// SeccompIoctlNotifAddfd installs a supervisor file descriptor into the notifying process.
+//
+// It returns the file descriptor number in the notifying process, or the
+// return value of the answered syscall if SECCOMP_ADDFD_FLAG_SEND is set.
+func SeccompIoctlNotifAddfd(fd int, addfd SeccompNotifAddfd) (int, error) {
+	ret, errno := ioctl(fd, SECCOMP_IOCTL_NOTIF_ADDFD, unsafe.Pointer(&addfd))
+	if errno != 0 {
+		return 0, errnoErr(errno)
+	}
+	return ret, nil
+}
@@ -0,0 +1,122 @@
+// SPDX-Licence-Identifier: MIT
+
+package lowlevel
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestSeccompNotifLayout(t *testing.T) {
+	if size := unsafe.Sizeof(SeccompNotif{}); size != 80 {
+		t.Errorf("SeccompNotif size should be 80, got %d", size)
+	}
+	if size := unsafe.Sizeof(SeccompNotifResp{}); size != 24 {
+		t.Errorf("SeccompNotifResp size should be 24, got %d", size)
+	}
+	if size := unsafe.Sizeof(SeccompNotifAddfd{}); size != 24 {
+		t.Errorf("SeccompNotifAddfd size should be 24, got %d", size)
+	}
+	sizes, err := SeccompGetNotifSizes()
+	if err != nil {
+		t.Skipf("Seccomp: %v, skipping test", err)
+	}
+	if int(sizes.SeccompData) < int(unsafe.Sizeof(SeccompData{})) {
+		t.Errorf("SeccompData size should be at least %d, kernel says %d", unsafe.Sizeof(SeccompData{}), sizes.SeccompData)
+	}
+}
+
+func TestSeccompIoctlRequests(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("ioctl numbers only checked on amd64 and arm64")
+	}
+	cases := []struct {
+		name     string
+		got      uint
+		expected uint
+	}{
+		{"SECCOMP_IOCTL_NOTIF_RECV", SECCOMP_IOCTL_NOTIF_RECV, 0xc0502100},
+		{"SECCOMP_IOCTL_NOTIF_SEND", SECCOMP_IOCTL_NOTIF_SEND, 0xc0182101},
+		{"SECCOMP_IOCTL_NOTIF_ID_VALID", SECCOMP_IOCTL_NOTIF_ID_VALID, 0x40082102},
+		{"SECCOMP_IOCTL_NOTIF_ADDFD", SECCOMP_IOCTL_NOTIF_ADDFD, 0x40182103},
+		{"SECCOMP_IOCTL_NOTIF_ID_VALID_WRONG_DIR", seccompIoctlNotifIDValidWrongDir, 0x80082102},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.expected {
+			t.Errorf("%s should be 0x%x, got 0x%x", tc.name, tc.expected, tc.got)
+		}
+	}
+}
+
+func TestSeccompIoctlNotif(t *testing.T) {
+	skipc := make(chan bool, 1)
+	fdc := make(chan int, 1)
+	skip := func() {
+		skipc <- true
+		runtime.Goexit()
+	}
+
+	go func() {
+		// This test uses seccomp to modify the calling thread, so run it on its own
+		// throwaway thread and do not unlock it when the goroutine exits.
+		runtime.LockOSThread()
+		defer close(skipc)
+
+		instructions, _ := bpf.Assemble([]bpf.Instruction{
+			LoadSeccompDataField("Number", false, runtime.GOARCH),
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: unix.SYS_GETPPID, SkipFalse: 1},
+			bpf.RetConstant{Val: SECCOMP_RET_USER_NOTIF},
+			bpf.RetConstant{Val: SECCOMP_RET_ALLOW},
+		})
+		err := NoNewPrivs()
+		if err != nil {
+			t.Logf("Prctl: %v, skipping test", err)
+			skip()
+		}
+		fd, err := SeccompSetModeFilter(instructions, SECCOMP_FILTER_FLAG_NEW_LISTENER)
+		if err != nil {
+			t.Logf("Seccomp: %v, skipping test", err)
+			skip()
+		}
+		fdc <- fd
+
+		ret, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+		if errno != 0 || ret != 42 {
+			t.Errorf("expected getppid to return 42, got %d (%v)", ret, errno)
+		}
+	}()
+
+	var fd int
+	select {
+	case fd = <-fdc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer unix.Close(fd)
+
+	notif, err := SeccompIoctlNotifRecv(fd)
+	if err != nil {
+		t.Fatalf("failed to receive notification: %v", err)
+	}
+	if notif.Data.Number != unix.SYS_GETPPID {
+		t.Errorf("expected syscall %d, got %d", unix.SYS_GETPPID, notif.Data.Number)
+	}
+	if notif.Data.Arch != GetAuditArch(runtime.GOARCH) {
+		t.Errorf("expected arch 0x%x, got 0x%x", GetAuditArch(runtime.GOARCH), notif.Data.Arch)
+	}
+	if err := SeccompIoctlNotifIDValid(fd, notif.Id); err != nil {
+		t.Errorf("notification should be valid: %v", err)
+	}
+	err = SeccompIoctlNotifSend(fd, SeccompNotifResp{Id: notif.Id, Val: 42})
+	if err != nil {
+		t.Errorf("failed to send response: %v", err)
+	}
+	if err := SeccompIoctlNotifIDValid(fd, notif.Id); err != unix.ENOENT {
+		t.Errorf("answered notification should be invalid, got %v", err)
+	}
+	<-skipc
+}
@@ -0,0 +1,69 @@
+// SPDX-Licence-Identifier: MIT
+
+package lowlevel
+
+import (
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Ptrace request to get the BPF program of a seccomp filter of the tracee
+	PTRACE_SECCOMP_GET_FILTER = 0x420c
+	// Ptrace request to get the flags of a seccomp filter of the tracee
+	PTRACE_SECCOMP_GET_METADATA = 0x420d
+)
+
+// SeccompMetadata mirrors the kernel seccomp_metadata structure, as filled by
+// [PtraceSeccompGetMetadata].
+type SeccompMetadata struct {
+	// FilterOff is the index of the filter in the stack, 0 being the first installed one
+	FilterOff uint64
+	// Flags holds the SECCOMP_FILTER_FLAG_* the filter was installed with, only
+	// SECCOMP_FILTER_FLAG_LOG is reported
+	Flags uint64
+}
+
+func ptrace(request int, pid int, addr uintptr, data uintptr) (int, error) {
+	ret, _, errno := unix.Syscall6(unix.SYS_PTRACE, uintptr(request), uintptr(pid), addr, data, 0, 0)
+	return int(ret), errnoErr(errno)
+}
+
+// PtraceSeccompGetFilter is a wrapper to ptrace(PTRACE_SECCOMP_GET_FILTER), it
+// returns the BPF program of the seccomp filter at the given index in the stack
+// of the tracee, 0 being the first installed filter.
+//
+// The tracee must be stopped and the caller must have CAP_SYS_ADMIN and not be
+// subject to seccomp filtering itself. ENOENT is returned past the last filter.
+func PtraceSeccompGetFilter(pid int, index uint) ([]bpf.RawInstruction, error) {
+	// The program length is returned when no buffer is given
+	length, err := ptrace(PTRACE_SECCOMP_GET_FILTER, pid, uintptr(index), 0)
+	if err != nil {
+		return nil, err
+	}
+	program := make([]bpf.RawInstruction, length)
+	if length == 0 {
+		return program, nil
+	}
+	_, err = ptrace(PTRACE_SECCOMP_GET_FILTER, pid, uintptr(index), uintptr(unsafe.Pointer(&program[0])))
+	if err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// PtraceSeccompGetMetadata is a wrapper to ptrace(PTRACE_SECCOMP_GET_METADATA),
+// it returns the metadata of the seccomp filter at the given index in the stack
+// of the tracee. It has the same requirements as [PtraceSeccompGetFilter].
+func PtraceSeccompGetMetadata(pid int, index uint) (SeccompMetadata, error) {
+	metadata := SeccompMetadata{FilterOff: uint64(index)}
+	_, err := ptrace(
+		PTRACE_SECCOMP_GET_METADATA,
+		pid,
+		unsafe.Sizeof(metadata),
+		uintptr(unsafe.Pointer(&metadata)),
+	)
+	return metadata, err
+}
@@ -6,6 +6,7 @@
 package lowlevel
 
 import (
+	"encoding/binary"
 	"unsafe"
 
 	"golang.org/x/net/bpf"
@@ -62,6 +63,14 @@ const (
 	SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV = 1 << 5
 )
 
+const (
+	// Maximum number of instructions of a BPF program
+	BPF_MAXINSNS = 4096
+	// Maximum number of instructions of all the seccomp filters of a thread, each filter
+	// accounting for 4 more instructions
+	MAX_INSNS_PER_PATH = 32768
+)
+
 // SeccompNotifSizes stores the sizes of the seccomp user-space notifications as returned by [SeccompGetNotifSizes]
 type SeccompNotifSizes struct {
 	// SeccompNotif stores the size of the notification structure
@@ -72,13 +81,49 @@ type SeccompNotifSizes struct {
 	SeccompData uint16
 }
 
-type seccompData struct {
+// SeccompData mirrors the kernel seccomp_data structure, which is the input
+// of seccomp BPF programs and is part of the user-space notifications.
+type SeccompData struct {
 	Number                             int32
 	Arch                               uint32
 	InstructionPointer                 uint64
 	Arg0, Arg1, Arg2, Arg3, Arg4, Arg5 uint64
 }
 
+// Bytes encodes the SeccompData as read by the BPF programs running on the given
+// GOARCH string, that is with the architecture endianness.
+func (d SeccompData) Bytes(goArch string) []byte {
+	var order binary.ByteOrder = binary.BigEndian
+	if ArchIsLittleEndian(goArch) {
+		order = binary.LittleEndian
+	}
+	data := make([]byte, unsafe.Sizeof(d))
+	order.PutUint32(data[unsafe.Offsetof(d.Number):], uint32(d.Number))
+	order.PutUint32(data[unsafe.Offsetof(d.Arch):], d.Arch)
+	order.PutUint64(data[unsafe.Offsetof(d.InstructionPointer):], d.InstructionPointer)
+	for i, arg := range []uint64{d.Arg0, d.Arg1, d.Arg2, d.Arg3, d.Arg4, d.Arg5} {
+		order.PutUint64(data[unsafe.Offsetof(d.Arg0)+uintptr(8*i):], arg)
+	}
+	return data
+}
+
+// SeccompDataFromBytes decodes seccomp data as encoded by the kernel
+// for the given architecture, it is the inverse of [SeccompData.Bytes].
+func SeccompDataFromBytes(data []byte, goArch string) SeccompData {
+	var order binary.ByteOrder = binary.BigEndian
+	if ArchIsLittleEndian(goArch) {
+		order = binary.LittleEndian
+	}
+	var d SeccompData
+	d.Number = int32(order.Uint32(data[unsafe.Offsetof(d.Number):]))
+	d.Arch = order.Uint32(data[unsafe.Offsetof(d.Arch):])
+	d.InstructionPointer = order.Uint64(data[unsafe.Offsetof(d.InstructionPointer):])
+	for i, arg := range []*uint64{&d.Arg0, &d.Arg1, &d.Arg2, &d.Arg3, &d.Arg4, &d.Arg5} {
+		*arg = order.Uint64(data[unsafe.Offsetof(d.Arg0)+uintptr(8*i):])
+	}
+	return d
+}
+
 // LoadSeccompDataField generates the [bpf.LoadAbsolute] instruction to access the given field
 // in the seccomp data available to the bfp program.
 // field must be one of "Number", "Arch", "InstructionPointer" or "ArgX" (with "X" from 0 to 5).
@@ -88,16 +133,15 @@ type seccompData struct {
 //
 // arch must be set to the target architecture of the filter and is used to use the right endianess
 func LoadSeccompDataField(field string, highByte bool, arch string) bpf.LoadAbsolute {
-	data := seccompData{}
+	data := SeccompData{}
 	_ = data
 	var offset uintptr
 	switch field {
 	case "Number":
-		offset = unsafe.Offsetof(data.Number)
-		highByte = false
+		// 32 bits fields don't depend on endianness
+		return bpf.LoadAbsolute{Off: uint32(unsafe.Offsetof(data.Number)), Size: 4}
 	case "Arch":
-		offset = unsafe.Offsetof(data.Arch)
-		highByte = false
+		return bpf.LoadAbsolute{Off: uint32(unsafe.Offsetof(data.Arch)), Size: 4}
 	case "InstructionPointer":
 		offset = unsafe.Offsetof(data.InstructionPointer)
 	case "Arg0":
@@ -122,6 +166,26 @@ func LoadSeccompDataField(field string, highByte bool, arch string) bpf.LoadAbso
 	}
 }
 
+// seccompDataFields lists the SeccompData fields names
+var seccompDataFields = []string{
+	"Number", "Arch", "InstructionPointer",
+	"Arg0", "Arg1", "Arg2", "Arg3", "Arg4", "Arg5",
+}
+
+// SeccompDataField returns the name of the SeccompData field loaded from the given
+// offset, and whether it is its high 32 bits, it is the inverse of LoadSeccompDataField.
+// The last value is false if no field is loaded from the offset.
+func SeccompDataField(offset uint32, arch string) (string, bool, bool) {
+	for _, field := range seccompDataFields {
+		for _, highByte := range []bool{false, true} {
+			if LoadSeccompDataField(field, highByte, arch).Off == offset {
+				return field, highByte && field != "Number" && field != "Arch", true
+			}
+		}
+	}
+	return "", false, false
+}
+
 type sockFprog struct {
 	len    uint16
 	filter uintptr
@@ -164,19 +228,29 @@ func SeccompGetNotifSizes() (SeccompNotifSizes, error) {
 //
 // SeccompSetModeFilter returns the file descriptor returned by the syscall if
 // SECCOMP_FILTER_FLAG_NEW_LISTENER is set and an error.
+//
+// If SECCOMP_FILTER_FLAG_TSYNC is set without SECCOMP_FILTER_FLAG_NEW_LISTENER and
+// a thread can't be synchronized, its thread id is returned along with ESRCH.
+//
+// Programs that are empty or longer than BPF_MAXINSNS are refused with EINVAL, as
+// the kernel does, their length wouldn't fit in the syscall structure.
 func SeccompSetModeFilter(prog []bpf.RawInstruction, flags uint) (int, error) {
+	if len(prog) == 0 || len(prog) > BPF_MAXINSNS {
+		return 0, unix.EINVAL
+	}
 	sock_prog := sockFprog{
 		len:    uint16(len(prog)),
 		filter: uintptr(unsafe.Pointer(&prog[0])),
 	}
 	ret, errno := seccomp(SECCOMP_SET_MODE_FILTER, flags, uintptr(unsafe.Pointer(&sock_prog)))
-	if (flags&SECCOMP_FILTER_FLAG_NEW_LISTENER != 0) && ret >= 0 {
-		return ret, nil
-	}
-	if ret != 0 {
+	if errno != 0 {
 		return 0, errnoErr(errno)
 	}
-	return 0, nil
+	if flags&SECCOMP_FILTER_FLAG_NEW_LISTENER == 0 && ret != 0 {
+		// The kernel returns the thread id instead of an error
+		return ret, unix.ESRCH
+	}
+	return ret, nil
 }
 
 // NoNewPrivs is a simple wrapper to [unix.Prctl] to set the "No New Privs" bit on the current
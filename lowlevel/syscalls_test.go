@@ -4,6 +4,7 @@ package lowlevel
 
 import (
 	"bufio"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -141,3 +142,70 @@ func TestSeccompInsertFilter(t *testing.T) {
 		t.SkipNow()
 	}
 }
+
+func TestSeccompSetModeFilterLength(t *testing.T) {
+	for _, length := range []int{0, BPF_MAXINSNS + 1, 1 << 16} {
+		prog := make([]bpf.RawInstruction, length)
+		if _, err := SeccompSetModeFilter(prog, 0); err != unix.EINVAL {
+			t.Errorf("%d instructions: Expected EINVAL got %v", length, err)
+		}
+	}
+}
+
+type TestCasesLoadSeccompDataField struct {
+	field    string
+	highByte bool
+	arch     string
+	expected uint32
+}
+
+func TestLoadSeccompDataField(t *testing.T) {
+	cases := []TestCasesLoadSeccompDataField{
+		{"Number", false, "amd64", 0},
+		{"Number", false, "s390x", 0},
+		{"Arch", true, "s390x", 4},
+		{"Arg0", false, "amd64", 16},
+		{"Arg0", true, "amd64", 20},
+		{"Arg0", false, "s390x", 20},
+		{"Arg0", true, "s390x", 16},
+		{"Arg5", false, "386", 56},
+	}
+	for i, tc := range cases {
+		got := LoadSeccompDataField(tc.field, tc.highByte, tc.arch)
+		if got.Off != tc.expected || got.Size != 4 {
+			t.Errorf("[%d/%d] Expected offset %d got %+v", i+1, len(cases), tc.expected, got)
+		}
+		field, highByte, ok := SeccompDataField(got.Off, tc.arch)
+		expectedHigh := tc.highByte && tc.field != "Number" && tc.field != "Arch"
+		if !ok || field != tc.field || highByte != expectedHigh {
+			t.Errorf("[%d/%d] Expected field %s (%t) got %s (%t)", i+1, len(cases), tc.field, expectedHigh, field, highByte)
+		}
+	}
+}
+
+func TestSeccompDataBytes(t *testing.T) {
+	data := SeccompData{Number: 1, Arch: 2, InstructionPointer: 3, Arg0: 0x100000004, Arg5: 5}
+	for _, arch := range []string{"amd64", "s390x", "386"} {
+		encoded := data.Bytes(arch)
+		if len(encoded) != 64 {
+			t.Fatalf("%s: Expected 64 bytes, got %d", arch, len(encoded))
+		}
+		fields := map[string]uint32{"Number": 1, "Arch": 2, "Arg0": 4, "Arg5": 5}
+		for field, expected := range fields {
+			load := LoadSeccompDataField(field, false, arch)
+			word := encoded[load.Off : load.Off+4]
+			var got uint32
+			if ArchIsLittleEndian(arch) {
+				got = binary.LittleEndian.Uint32(word)
+			} else {
+				got = binary.BigEndian.Uint32(word)
+			}
+			if got != expected {
+				t.Errorf("%s: %s Expected '%d' got '%d'", arch, field, expected, got)
+			}
+		}
+		if decoded := SeccompDataFromBytes(encoded, arch); decoded != data {
+			t.Errorf("%s: Expected '%+v' got '%+v'", arch, data, decoded)
+		}
+	}
+}
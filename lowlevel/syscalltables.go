@@ -0,0 +1,64 @@
+// SPDX-Licence-Identifier: MIT
+
+package lowlevel
+
+import "sync"
+
+//go:generate go run mksyscalltables.go $GOROOT/src/cmd/vendor/golang.org/x/sys/unix $LINUX_UAPI_HEADERS
+
+// X32_SYSCALL_BIT is set in the number of the x32 ABI syscalls, which are
+// reported with the AUDIT_ARCH_X86_64 architecture.
+const X32_SYSCALL_BIT = 0x40000000
+
+var (
+	syscallNamesOnce sync.Once
+	syscallNames     map[string]map[uint]string
+)
+
+// tableArch returns the architecture which syscall table is used for the given
+// GOARCH string, big endian ARM variants share the little endian numbering.
+func tableArch(goArch string) string {
+	switch goArch {
+	case "armbe":
+		return "arm"
+	case "arm64be":
+		return "arm64"
+	default:
+		return goArch
+	}
+}
+
+// SyscallNumber returns the number of the named syscall (e.g. "openat") on the given
+// GOARCH string (as in [runtime.GOARCH]). The "x32" pseudo architecture gives the
+// x32 ABI numbers, X32_SYSCALL_BIT included.
+//
+// The second returned value is false if the syscall doesn't exist on that architecture,
+// or if there is no syscall table for that architecture.
+func SyscallNumber(goArch string, name string) (uint, bool) {
+	number, ok := syscallTables[tableArch(goArch)][name]
+	return number, ok
+}
+
+// SyscallName returns the name of the syscall number on the given GOARCH string,
+// the second returned value is false if the number is unknown.
+func SyscallName(goArch string, number uint) (string, bool) {
+	syscallNamesOnce.Do(func() {
+		syscallNames = make(map[string]map[uint]string, len(syscallTables))
+		for arch, table := range syscallTables {
+			names := make(map[uint]string, len(table))
+			for name, number := range table {
+				names[number] = name
+			}
+			syscallNames[arch] = names
+		}
+	})
+	name, ok := syscallNames[tableArch(goArch)][number]
+	return name, ok
+}
+
+// HasSyscallTable tells whether syscalls of the given GOARCH string can be resolved by name,
+// which is the case for all the architectures known by [GetAuditArch].
+func HasSyscallTable(goArch string) bool {
+	_, ok := syscallTables[tableArch(goArch)]
+	return ok
+}
@@ -0,0 +1,112 @@
+// SPDX-Licence-Identifier: MIT
+
+package lowlevel
+
+import (
+	"runtime"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+type TestCasesSyscallTables struct {
+	arch   string
+	name   string
+	number uint
+	found  bool
+}
+
+func TestSyscallTables(t *testing.T) {
+	cases := []TestCasesSyscallTables{
+		{"amd64", "read", 0, true},
+		{"amd64", "openat", 257, true},
+		{"386", "openat", 295, true},
+		{"arm64", "openat", 56, true},
+		{"arm64be", "openat", 56, true},
+		{"arm", "cacheflush", 0x0f0002, true},
+		{"armbe", "getpid", 20, true},
+		{"mips", "getpid", 4020, true},
+		{"mips64le", "getpid", 5038, true},
+		{"s390x", "getpid", 20, true},
+		{"x32", "rt_sigaction", X32_SYSCALL_BIT + 512, true},
+		{"x32", "getpid", X32_SYSCALL_BIT + 39, true},
+		{"arm64", "open", 0, false},
+		{"amd64", "not_a_syscall", 0, false},
+		{"mips64p32le", "getpid", 6038, true},
+		{"riscv", "getpid", 172, true},
+		{"riscv", "clock_gettime", 0, false},
+		{"s390", "_llseek", 140, true},
+		{"sparc", "getpid", 20, true},
+		{"unknown", "getpid", 0, false},
+	}
+	for i, tc := range cases {
+		number, found := SyscallNumber(tc.arch, tc.name)
+		if number != tc.number || found != tc.found {
+			t.Errorf(
+				"[%d/%d] %s/%s: Expected '%d, %t' Got '%d, %t'",
+				i+1, len(cases),
+				tc.arch, tc.name,
+				tc.number, tc.found,
+				number, found,
+			)
+		}
+		if !tc.found {
+			continue
+		}
+		name, found := SyscallName(tc.arch, tc.number)
+		if name != tc.name || !found {
+			t.Errorf(
+				"[%d/%d] %s/%d: Expected '%s' Got '%s, %t'",
+				i+1, len(cases),
+				tc.arch, tc.number,
+				tc.name,
+				name, found,
+			)
+		}
+	}
+}
+
+func TestSyscallTablesAllArchitectures(t *testing.T) {
+	cases := []string{
+		"386", "amd64", "arm", "arm64", "armbe", "arm64be", "loong64", "mips",
+		"mips64", "mips64le", "mips64p32", "mips64p32le", "mipsle", "ppc", "ppc64",
+		"ppc64le", "riscv", "riscv64", "s390", "s390x", "sparc", "sparc64",
+	}
+	for i, arch := range cases {
+		if GetAuditArch(arch) == 0 {
+			t.Errorf("[%d/%d] %s: Expected a known architecture", i+1, len(cases), arch)
+		}
+		if !HasSyscallTable(arch) {
+			t.Errorf("[%d/%d] %s: Expected a syscall table", i+1, len(cases), arch)
+		}
+	}
+}
+
+func TestSyscallTablesRoundTrip(t *testing.T) {
+	for arch, table := range syscallTables {
+		for name, number := range table {
+			got, ok := SyscallName(arch, number)
+			if !ok || got != name {
+				t.Errorf("%s: number %d resolves to '%s' instead of '%s'", arch, number, got, name)
+			}
+		}
+	}
+}
+
+func TestSyscallTablesHost(t *testing.T) {
+	if !HasSyscallTable(runtime.GOARCH) {
+		t.Skipf("no syscall table for %s", runtime.GOARCH)
+	}
+	cases := map[string]uint{
+		"getpid":  unix.SYS_GETPID,
+		"openat":  unix.SYS_OPENAT,
+		"seccomp": unix.SYS_SECCOMP,
+		"ioctl":   unix.SYS_IOCTL,
+	}
+	for name, expected := range cases {
+		number, ok := SyscallNumber(runtime.GOARCH, name)
+		if !ok || number != expected {
+			t.Errorf("%s: Expected '%d' Got '%d, %t'", name, expected, number, ok)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+// ProcessGoneError is returned when the notifying process exited or the
+// notification got answered or cancelled, data read from its memory must
+// then be discarded as the pid might have been reused.
+type ProcessGoneError struct {
+	// Pid is the thread id of the notifying thread
+	Pid uint32
+	// Err is the underlying error
+	Err error
+}
+
+func (e *ProcessGoneError) Error() string {
+	return fmt.Sprintf("notifying process %d is gone: %v", e.Pid, e.Err)
+}
+
+func (e *ProcessGoneError) Unwrap() error { return e.Err }
+
+func (n *Notification) goneErr(err error) error {
+	switch err {
+	case unix.ENOENT, unix.ESRCH:
+		return &ProcessGoneError{Pid: n.Pid, Err: err}
+	}
+	if os.IsNotExist(err) {
+		return &ProcessGoneError{Pid: n.Pid, Err: err}
+	}
+	return err
+}
+
+// Valid checks the Notification is still pending, it returns a
+// [ProcessGoneError] if it is not.
+func (n *Notification) Valid() error {
+	fd := n.listener.Fd()
+	if fd < 0 {
+		return os.ErrClosed
+	}
+	return n.goneErr(lowlevel.SeccompIoctlNotifIDValid(fd, n.ID))
+}
+
+func (n *Notification) readProcessVM(addr uint64, buf []byte) (int, error) {
+	local := []unix.Iovec{{Base: &buf[0]}}
+	local[0].SetLen(len(buf))
+	remote := []unix.RemoteIovec{{Base: uintptr(addr), Len: len(buf)}}
+	return unix.ProcessVMReadv(int(n.Pid), local, remote, 0)
+}
+
+func (n *Notification) readProcMem(addr uint64, buf []byte) (int, error) {
+	mem, err := os.Open(fmt.Sprintf("/proc/%d/mem", n.Pid))
+	if err != nil {
+		return 0, err
+	}
+	defer mem.Close()
+	return unix.Pread(int(mem.Fd()), buf, int64(addr))
+}
+
+// ReadMemory reads the memory of the notifying process at addr into buf,
+// it returns the number of bytes read which might be lower than len(buf)
+// if the end of the range isn't mapped.
+//
+// The read uses process_vm_readv and falls back to /proc/<pid>/mem if
+// unavailable. The Notification validity is checked after the read.
+func (n *Notification) ReadMemory(addr uint64, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, n.Valid()
+	}
+	read, err := n.readProcessVM(addr, buf)
+	if err == unix.ENOSYS || err == unix.EPERM {
+		read, err = n.readProcMem(addr, buf)
+	}
+	if err != nil {
+		return 0, n.goneErr(err)
+	}
+	if err := n.Valid(); err != nil {
+		return 0, err
+	}
+	return read, nil
+}
+
+// ReadString reads a NUL terminated string from the memory of the notifying
+// process at addr. It returns ENAMETOOLONG if no NUL byte is found within
+// the first maxLen bytes.
+func (n *Notification) ReadString(addr uint64, maxLen int) (string, error) {
+	pageSize := uint64(os.Getpagesize())
+	var str []byte
+	for len(str) < maxLen {
+		// Don't cross page boundaries, the next page might not be mapped
+		chunk := int(pageSize - addr%pageSize)
+		if chunk > maxLen-len(str) {
+			chunk = maxLen - len(str)
+		}
+		buf := make([]byte, chunk)
+		read, err := n.ReadMemory(addr, buf)
+		if err != nil {
+			return "", err
+		}
+		if read == 0 {
+			return "", unix.EFAULT
+		}
+		if i := bytes.IndexByte(buf[:read], 0); i >= 0 {
+			return string(append(str, buf[:i]...)), nil
+		}
+		str = append(str, buf[:read]...)
+		addr += uint64(read)
+	}
+	return "", unix.ENAMETOOLONG
+}
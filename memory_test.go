@@ -0,0 +1,68 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNotificationReadString(t *testing.T) {
+	path := []byte("/some/supervised/path\x00")
+	done := make(chan struct{})
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_CHDIR), func() {
+		defer close(done)
+		ret, _, errno := unix.Syscall(unix.SYS_CHDIR, uintptr(unsafe.Pointer(&path[0])), 0, 0)
+		if errno != 0 || ret != uintptr(len(path)-1) {
+			t.Errorf("expected chdir to return %d, got %d (%v)", len(path)-1, ret, errno)
+		}
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	supervisor := NewSupervisor(listener)
+	supervisor.Handle(runtime.GOARCH, unix.SYS_CHDIR, func(ctx context.Context, n *Notification) Response {
+		str, err := n.ReadString(n.Args[0], 4096)
+		if err != nil {
+			t.Errorf("failed to read string: %v", err)
+			return ReturnErrno(unix.EFAULT)
+		}
+		if str != string(path[:len(path)-1]) {
+			t.Errorf("expected %q, got %q", path[:len(path)-1], str)
+		}
+		_, err = n.ReadString(n.Args[0], 4)
+		if err != unix.ENAMETOOLONG {
+			t.Errorf("expected ENAMETOOLONG, got %v", err)
+		}
+		return ReturnValue(int64(len(str)))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	supervisor.Run(ctx)
+}
+
+func TestNotificationReadMemoryGone(t *testing.T) {
+	n := &Notification{Pid: 0x3fffffff, listener: NewListener(-1)}
+	_, err := n.ReadMemory(0x1000, make([]byte, 8))
+	var gone *ProcessGoneError
+	if !errors.As(err, &gone) {
+		t.Fatalf("expected ProcessGoneError, got %v", err)
+	}
+	if gone.Pid != 0x3fffffff {
+		t.Errorf("expected pid 0x3fffffff, got %d", gone.Pid)
+	}
+}
@@ -0,0 +1,275 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+// Notification is a syscall forwarded by the UserNotify decision and
+// waiting for a Response from the supervisor.
+type Notification struct {
+	// ID is the kernel cookie identifying the notification
+	ID uint64
+	// Pid is the thread id of the notifying thread, in the listener pid namespace
+	Pid uint32
+	// Arch is the audit architecture of the syscall (see [lowlevel.GetAuditArch])
+	Arch uint32
+	// Number is the syscall number, as in [SyscallCallFilter] Number
+	Number uint
+	// InstructionPointer is the address of the syscall instruction
+	InstructionPointer uint64
+	// Args are the six raw syscall arguments
+	Args [6]uint64
+
+	listener *Listener
+}
+
+// Response is the answer of the supervisor to a Notification.
+type Response struct {
+	// Value is the value returned by the syscall if Errno is 0
+	Value int64
+	// Errno is the error returned by the syscall
+	Errno unix.Errno
+	// Continue lets the kernel execute the syscall, Value and Errno are then ignored.
+	//
+	// As the notifying process memory might have been modified since the notification,
+	// this must not be used to take security decisions.
+	Continue bool
+
+	inject *fdInjection
+}
+
+// fdInjection describes a supervisor file descriptor to install in the notifying process
+type fdInjection struct {
+	fd      int
+	target  int
+	cloexec bool
+}
+
+func (i *fdInjection) toNotifAddfd(id uint64) lowlevel.SeccompNotifAddfd {
+	addfd := lowlevel.SeccompNotifAddfd{Id: id, Srcfd: uint32(i.fd)}
+	if i.target >= 0 {
+		addfd.Flags |= lowlevel.SECCOMP_ADDFD_FLAG_SETFD
+		addfd.Newfd = uint32(i.target)
+	}
+	if i.cloexec {
+		addfd.NewfdFlags = unix.O_CLOEXEC
+	}
+	return addfd
+}
+
+// ReturnValue makes the notified syscall return the given value.
+func ReturnValue(value int64) Response { return Response{Value: value} }
+
+// ReturnErrno makes the notified syscall fail with the given errno.
+func ReturnErrno(errno unix.Errno) Response { return Response{Errno: errno} }
+
+// Continue lets the kernel execute the notified syscall.
+func Continue() Response { return Response{Continue: true} }
+
+// ReturnFD installs the supervisor file descriptor fd into the notifying process
+// and makes the notified syscall return its number there. The fd stays owned by
+// the supervisor.
+//
+// If the kernel doesn't support file descriptor injection, the syscall fails with
+// the returned Response Errno (ENOSYS unless changed) and Respond returns
+// [ErrAddFDUnsupported]. If the injection itself fails, the syscall fails with
+// its errno and Respond returns an [InjectFDError].
+func ReturnFD(fd int, cloexec bool) Response {
+	return Response{
+		Errno:  unix.ENOSYS,
+		inject: &fdInjection{fd: fd, target: -1, cloexec: cloexec},
+	}
+}
+
+// ReturnFDAt behaves like [ReturnFD] but installs fd at the target file descriptor
+// number, closing any file previously using that number, as dup2 would.
+func ReturnFDAt(fd int, target int, cloexec bool) Response {
+	r := ReturnFD(fd, cloexec)
+	r.inject.target = target
+	return r
+}
+
+func (r Response) toNotifResp(id uint64) lowlevel.SeccompNotifResp {
+	resp := lowlevel.SeccompNotifResp{Id: id}
+	switch {
+	case r.Continue:
+		resp.Flags = lowlevel.SECCOMP_USER_NOTIF_FLAG_CONTINUE
+	case r.Errno != 0:
+		resp.Error = -int32(r.Errno)
+	default:
+		resp.Val = r.Value
+	}
+	return resp
+}
+
+// Receive waits for the next Notification on the Listener.
+//
+// It returns ENOENT if the notifying thread got killed before the
+// notification could be read, the caller can simply retry.
+func (l *Listener) Receive() (*Notification, error) {
+	fd := l.Fd()
+	if fd < 0 {
+		return nil, os.ErrClosed
+	}
+	notif, err := lowlevel.SeccompIoctlNotifRecv(fd)
+	if err != nil {
+		return nil, err
+	}
+	data := notif.Data
+	return &Notification{
+		ID:                 notif.Id,
+		Pid:                notif.Pid,
+		Arch:               data.Arch,
+		Number:             uint(uint32(data.Number)),
+		InstructionPointer: data.InstructionPointer,
+		Args:               [6]uint64{data.Arg0, data.Arg1, data.Arg2, data.Arg3, data.Arg4, data.Arg5},
+		listener:           l,
+	}, nil
+}
+
+// Respond sends the Response to the notifying thread.
+//
+// It returns ENOENT if the notifying thread got killed in the meantime.
+func (n *Notification) Respond(r Response) error {
+	fd := n.listener.Fd()
+	if fd < 0 {
+		return os.ErrClosed
+	}
+	if r.inject != nil {
+		return n.respondFD(fd, r)
+	}
+	return lowlevel.SeccompIoctlNotifSend(fd, r.toNotifResp(n.ID))
+}
+
+// ErrAddFDUnsupported is returned when the kernel doesn't support injecting
+// file descriptors into the notifying process (linux < 5.9).
+var ErrAddFDUnsupported = errors.New("seccomp file descriptor injection unsupported by the kernel")
+
+// Support of SECCOMP_IOCTL_NOTIF_ADDFD by the kernel, as probed by probeAddfd
+const (
+	addfdUnprobed int32 = iota
+	// linux < 5.9
+	addfdUnsupported
+	// linux < 5.14, SECCOMP_ADDFD_FLAG_SEND is unsupported
+	addfdWithoutSend
+	addfdWithSend
+)
+
+// addfdSupport caches the SECCOMP_IOCTL_NOTIF_ADDFD support of the kernel
+var addfdSupport atomic.Int32
+
+func isUnsupportedIoctl(err error) bool {
+	return err == unix.EINVAL || err == unix.ENOTTY
+}
+
+// probeAddfd returns the SECCOMP_IOCTL_NOTIF_ADDFD support of the kernel, probing
+// it on the listener fd the first time. The probe gives an invalid source file
+// descriptor, which the kernel only checks once it knows the ioctl and its flags,
+// so that EBADF tells they are supported and nothing gets installed.
+func probeAddfd(fd int) (int32, error) {
+	if support := addfdSupport.Load(); support != addfdUnprobed {
+		return support, nil
+	}
+	addfd := lowlevel.SeccompNotifAddfd{Flags: lowlevel.SECCOMP_ADDFD_FLAG_SEND, Srcfd: ^uint32(0)}
+	support := addfdWithSend
+	for support != addfdUnsupported {
+		_, err := lowlevel.SeccompIoctlNotifAddfd(fd, addfd)
+		if err == unix.EBADF {
+			break
+		}
+		if !isUnsupportedIoctl(err) {
+			return addfdUnprobed, err
+		}
+		addfd.Flags = 0
+		support--
+	}
+	addfdSupport.Store(support)
+	return support, nil
+}
+
+// InjectFDError is returned by Respond when the file descriptor of a
+// [ReturnFD] Response couldn't be installed, the notified syscall then
+// failed with the errno of the injection.
+type InjectFDError struct {
+	// Err is the error of the SECCOMP_IOCTL_NOTIF_ADDFD ioctl
+	Err error
+}
+
+func (e *InjectFDError) Error() string {
+	return fmt.Sprintf("cannot inject file descriptor: %v", e.Err)
+}
+
+func (e *InjectFDError) Unwrap() error { return e.Err }
+
+func (n *Notification) respondFD(fd int, r Response) error {
+	support, err := probeAddfd(fd)
+	if err != nil {
+		return n.refuseFD(fd, err)
+	}
+	addfd := r.inject.toNotifAddfd(n.ID)
+	switch support {
+	case addfdUnsupported:
+		err = lowlevel.SeccompIoctlNotifSend(fd, Response{Errno: r.Errno}.toNotifResp(n.ID))
+		if err != nil {
+			return err
+		}
+		return ErrAddFDUnsupported
+	case addfdWithSend:
+		addfd.Flags |= lowlevel.SECCOMP_ADDFD_FLAG_SEND
+		_, err := lowlevel.SeccompIoctlNotifAddfd(fd, addfd)
+		return n.refuseFD(fd, err)
+	}
+	// Non atomic fallback, install the file descriptor then answer
+	newfd, err := lowlevel.SeccompIoctlNotifAddfd(fd, addfd)
+	if err != nil {
+		return n.refuseFD(fd, err)
+	}
+	return lowlevel.SeccompIoctlNotifSend(fd, ReturnValue(int64(newfd)).toNotifResp(n.ID))
+}
+
+// refuseFD answers the notification with the errno of a failed injection so
+// that the notifying thread doesn't stay blocked.
+func (n *Notification) refuseFD(fd int, err error) error {
+	if err == nil || err == unix.ENOENT {
+		return err
+	}
+	errno, ok := err.(unix.Errno)
+	if !ok {
+		errno = unix.EIO
+	}
+	sendErr := lowlevel.SeccompIoctlNotifSend(fd, ReturnErrno(errno).toNotifResp(n.ID))
+	if sendErr != nil {
+		return sendErr
+	}
+	return &InjectFDError{Err: err}
+}
+
+// InjectFD installs the supervisor file descriptor fd into the notifying
+// process without answering the Notification, it returns the file descriptor
+// number in the notifying process.
+//
+// It returns [ErrAddFDUnsupported] if the kernel doesn't support file descriptor
+// injection, and the ioctl errno if the injection fails.
+func (n *Notification) InjectFD(fd int, cloexec bool) (int, error) {
+	listenerFd := n.listener.Fd()
+	if listenerFd < 0 {
+		return 0, os.ErrClosed
+	}
+	support, err := probeAddfd(listenerFd)
+	if err != nil {
+		return 0, err
+	}
+	if support == addfdUnsupported {
+		return 0, ErrAddFDUnsupported
+	}
+	injection := fdInjection{fd: fd, target: -1, cloexec: cloexec}
+	return lowlevel.SeccompIoctlNotifAddfd(listenerFd, injection.toNotifAddfd(n.ID))
+}
@@ -0,0 +1,156 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+func TestResponseToNotifResp(t *testing.T) {
+	cases := []struct {
+		response Response
+		expected lowlevel.SeccompNotifResp
+	}{
+		{ReturnValue(42), lowlevel.SeccompNotifResp{Id: 1, Val: 42}},
+		{ReturnErrno(unix.EPERM), lowlevel.SeccompNotifResp{Id: 1, Error: -int32(unix.EPERM)}},
+		{Continue(), lowlevel.SeccompNotifResp{Id: 1, Flags: lowlevel.SECCOMP_USER_NOTIF_FLAG_CONTINUE}},
+	}
+	for i, tc := range cases {
+		got := tc.response.toNotifResp(1)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"[%d/%d] Expected: %+v Got: %+v",
+				i+1, len(cases),
+				tc.expected,
+				got,
+			)
+		}
+	}
+}
+
+func TestResponseReturnFD(t *testing.T) {
+	path := []byte("/emulated\x00")
+	atFdCwd := unix.AT_FDCWD
+	file, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var expected unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_OPENAT), func() {
+		defer close(done)
+		fd, _, errno := unix.Syscall6(
+			unix.SYS_OPENAT,
+			uintptr(atFdCwd), uintptr(unsafe.Pointer(&path[0])), unix.O_RDONLY,
+			0, 0, 0,
+		)
+		if errno != 0 {
+			t.Errorf("emulated openat failed: %v", errno)
+			return
+		}
+		defer unix.Close(int(fd))
+		var got unix.Stat_t
+		if err := unix.Fstat(int(fd), &got); err != nil {
+			t.Errorf("fstat: %v", err)
+		}
+		if got.Dev != expected.Dev || got.Ino != expected.Ino {
+			t.Errorf("injected file descriptor doesn't refer to %s", os.DevNull)
+		}
+		flags, err := unix.FcntlInt(fd, unix.F_GETFD, 0)
+		if err != nil || flags&unix.FD_CLOEXEC == 0 {
+			t.Errorf("injected file descriptor should be close-on-exec (flags %d, %v)", flags, err)
+		}
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	supervisor := NewSupervisor(listener)
+	supervisor.Handle(runtime.GOARCH, unix.SYS_OPENAT, func(ctx context.Context, n *Notification) Response {
+		return ReturnFD(int(file.Fd()), true)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	supervisor.Run(ctx)
+}
+
+func TestResponseReturnFDInjectionFailure(t *testing.T) {
+	path := []byte("/emulated\x00")
+	atFdCwd := unix.AT_FDCWD
+
+	done := make(chan struct{})
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_OPENAT), func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			_, _, errno := unix.Syscall6(
+				unix.SYS_OPENAT,
+				uintptr(atFdCwd), uintptr(unsafe.Pointer(&path[0])), unix.O_RDONLY,
+				0, 0, 0,
+			)
+			if errno != unix.EBADF {
+				t.Errorf("[%d/2] Expected '%v' got '%v'", i+1, unix.EBADF, errno)
+			}
+		}
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	supervisor := NewSupervisor(listener)
+	supervisor.Handle(runtime.GOARCH, unix.SYS_OPENAT, func(ctx context.Context, n *Notification) Response {
+		// Not a file descriptor of the supervisor
+		return ReturnFD(-1, false)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	if err := supervisor.Run(ctx); err != context.Canceled {
+		t.Errorf("Expected the supervisor to run until cancelled, got %v", err)
+	}
+}
+
+func TestProbeAddfd(t *testing.T) {
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_GETPPID), func() {})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	addfdSupport.Store(addfdUnprobed)
+	support, err := probeAddfd(listener.Fd())
+	if err != nil || support == addfdUnprobed {
+		t.Fatalf("Expected the probe to succeed, got %d (%v)", support, err)
+	}
+	if cached := addfdSupport.Load(); cached != support {
+		t.Errorf("Expected the support %d to be cached, got %d", support, cached)
+	}
+}
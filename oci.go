@@ -0,0 +1,555 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+// OCISeccomp is the LinuxSeccomp structure of the OCI runtime specification
+type OCISeccomp struct {
+	DefaultAction    string       `json:"defaultAction"`
+	DefaultErrnoRet  *uint        `json:"defaultErrnoRet,omitempty"`
+	Architectures    []string     `json:"architectures,omitempty"`
+	Flags            []string     `json:"flags,omitempty"`
+	ListenerPath     string       `json:"listenerPath,omitempty"`
+	ListenerMetadata string       `json:"listenerMetadata,omitempty"`
+	Syscalls         []OCISyscall `json:"syscalls,omitempty"`
+}
+
+// OCISyscall is a LinuxSyscall rule of an OCI seccomp profile
+type OCISyscall struct {
+	Names    []string        `json:"names"`
+	Action   string          `json:"action"`
+	ErrnoRet *uint           `json:"errnoRet,omitempty"`
+	Args     []OCISeccompArg `json:"args,omitempty"`
+}
+
+// OCISeccompArg is a LinuxSeccompArg condition of an OCI seccomp rule
+type OCISeccompArg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+// ociArchitectures maps the libseccomp architecture names to the Go ones,
+// SCMP_ARCH_X32 is handled with the X32Policy.
+var ociArchitectures = map[string]string{
+	"SCMP_ARCH_X86":         "386",
+	"SCMP_ARCH_X86_64":      "amd64",
+	"SCMP_ARCH_ARM":         "arm",
+	"SCMP_ARCH_AARCH64":     "arm64",
+	"SCMP_ARCH_LOONGARCH64": "loong64",
+	"SCMP_ARCH_MIPS":        "mips",
+	"SCMP_ARCH_MIPS64":      "mips64",
+	"SCMP_ARCH_MIPS64N32":   "mips64p32",
+	"SCMP_ARCH_MIPSEL":      "mipsle",
+	"SCMP_ARCH_MIPSEL64":    "mips64le",
+	"SCMP_ARCH_MIPSEL64N32": "mips64p32le",
+	"SCMP_ARCH_PPC":         "ppc",
+	"SCMP_ARCH_PPC64":       "ppc64",
+	"SCMP_ARCH_PPC64LE":     "ppc64le",
+	"SCMP_ARCH_RISCV64":     "riscv64",
+	"SCMP_ARCH_S390":        "s390",
+	"SCMP_ARCH_S390X":       "s390x",
+}
+
+const ociArchX32 = "SCMP_ARCH_X32"
+
+// ociFlags are the SECCOMP_FILTER_FLAG_* flags of a profile that can be set in
+// the Filter Flags, in the order they are written.
+var ociFlags = []struct {
+	name string
+	flag uint
+}{
+	{"SECCOMP_FILTER_FLAG_LOG", lowlevel.SECCOMP_FILTER_FLAG_LOG},
+	{"SECCOMP_FILTER_FLAG_SPEC_ALLOW", lowlevel.SECCOMP_FILTER_FLAG_SPEC_ALLOW},
+	{"SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV", lowlevel.SECCOMP_FILTER_FLAG_WAIT_KILLABLE_RECV},
+}
+
+// ociFlag returns the Filter Flags value of a profile flag
+func ociFlag(name string) (uint, error) {
+	for _, flag := range ociFlags {
+		if flag.name == name {
+			return flag.flag, nil
+		}
+	}
+	return 0, fmt.Errorf("flag '%s' not supported", name)
+}
+
+// ociDecision converts a SCMP_ACT_* action into a Decision, ERRNO and TRACE
+// actions default to EPERM as in runc.
+func ociDecision(action string, errnoRet *uint) (Decision, error) {
+	var decision Decision
+	switch action {
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		decision.Type = KillThread
+	case "SCMP_ACT_KILL_PROCESS":
+		decision.Type = KillProcess
+	case "SCMP_ACT_TRAP":
+		decision.Type = Trap
+	case "SCMP_ACT_ERRNO":
+		decision.Type = Errno
+	case "SCMP_ACT_TRACE":
+		decision.Type = Trace
+	case "SCMP_ACT_ALLOW":
+		decision.Type = Allow
+	case "SCMP_ACT_LOG":
+		decision.Type = Log
+	case "SCMP_ACT_NOTIFY":
+		decision.Type = UserNotify
+	default:
+		return Decision{}, fmt.Errorf("unknown action '%s'", action)
+	}
+	if decision.Type != Errno && decision.Type != Trace {
+		if errnoRet != nil {
+			return Decision{}, fmt.Errorf("errnoRet can't be used with action '%s'", action)
+		}
+		return decision, nil
+	}
+	decision.Data = uint16(unix.EPERM)
+	if errnoRet != nil {
+		if *errnoRet > 0xffff {
+			return Decision{}, fmt.Errorf("errnoRet %d out of range", *errnoRet)
+		}
+		decision.Data = uint16(*errnoRet)
+	}
+	return decision, nil
+}
+
+// ociArgument converts a SCMP_CMP_* condition into a SyscallArgument
+func ociArgument(arg OCISeccompArg) (SyscallArgument, error) {
+	if uint64(uintptr(arg.Value)) != arg.Value || uint64(uintptr(arg.ValueTwo)) != arg.ValueTwo {
+		return SyscallArgument{}, fmt.Errorf("argument %d value doesn't fit in a uintptr", arg.Index)
+	}
+	value := uintptr(arg.Value)
+	switch arg.Op {
+	case "SCMP_CMP_NE":
+		return NotEqual(value), nil
+	case "SCMP_CMP_LT":
+		return LessThan(value), nil
+	case "SCMP_CMP_LE":
+		return LessOrEqual(value), nil
+	case "SCMP_CMP_EQ":
+		return Equal(value), nil
+	case "SCMP_CMP_GE":
+		return GreaterOrEqual(value), nil
+	case "SCMP_CMP_GT":
+		return GreaterThan(value), nil
+	case "SCMP_CMP_MASKED_EQ":
+		return MaskedEqual(value, uintptr(arg.ValueTwo)), nil
+	default:
+		return SyscallArgument{}, fmt.Errorf("unknown operator '%s'", arg.Op)
+	}
+}
+
+// ociArguments converts the conditions of a rule into the argument checks of
+// the SyscallCallFilters it gives. As done by runc, conditions on distinct
+// arguments must all match, but as soon as an argument has several conditions
+// each condition gives a SyscallCallFilter of its own, any of them matching.
+func ociArguments(args []OCISeccompArg) ([][6]SyscallArgument, error) {
+	anyArgs := [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}
+	var counts [6]int
+	alternatives := false
+	converted := make([]SyscallArgument, len(args))
+	for i, arg := range args {
+		if arg.Index >= 6 {
+			return nil, fmt.Errorf("argument index %d out of range", arg.Index)
+		}
+		counts[arg.Index]++
+		alternatives = alternatives || counts[arg.Index] > 1
+		argument, err := ociArgument(arg)
+		if err != nil {
+			return nil, err
+		}
+		converted[i] = argument
+	}
+	if !alternatives {
+		for i, arg := range args {
+			anyArgs[arg.Index] = converted[i]
+		}
+		return [][6]SyscallArgument{anyArgs}, nil
+	}
+	result := make([][6]SyscallArgument, len(args))
+	for i, arg := range args {
+		result[i] = anyArgs
+		result[i][arg.Index] = converted[i]
+	}
+	return result, nil
+}
+
+// ociRule is a rule of a profile with its converted decision and arguments
+type ociRule struct {
+	names     []string
+	decision  Decision
+	arguments [][6]SyscallArgument
+}
+
+// checkArguments checks that the argument conditions of the rule fit the
+// architecture when one of its syscalls is known there.
+func (r ociRule) checkArguments(arch string) error {
+	known := false
+	for _, name := range r.names {
+		if _, ok := lowlevel.SyscallNumber(arch, name); ok {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil
+	}
+	for _, args := range r.arguments {
+		for i, arg := range args {
+			if !arg.fitsArch(arch) {
+				return fmt.Errorf("argument %d value doesn't fit in 32 bits on architecture '%s'", i, arch)
+			}
+		}
+	}
+	return nil
+}
+
+// sortOCIRules orders the rules by the precedence of their actions, as
+// libseccomp does when several rules match a syscall: the kernel action values,
+// read as signed, are ordered from the highest priority KillProcess to Allow.
+// Rules having the same action keep the profile order.
+func sortOCIRules(rules []ociRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return int32(rules[i].decision.Type) < int32(rules[j].decision.Type)
+	})
+}
+
+// ociElements returns the FilterElements of the rules, syscall names being
+// resolved on the given syscall table. Names unknown there are ignored.
+func ociElements(rules []ociRule, table string) []FilterElement {
+	var elements []FilterElement
+	for _, rule := range rules {
+		element := FilterElement{Decision: rule.decision}
+		for _, name := range rule.names {
+			number, ok := lowlevel.SyscallNumber(table, name)
+			if !ok {
+				continue
+			}
+			for _, args := range rule.arguments {
+				element.Match = append(element.Match, SyscallCallFilter{Number: number, Args: args})
+			}
+		}
+		if len(element.Match) != 0 {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// ParseOCISeccomp parses an OCI runtime-spec seccomp profile (the "seccomp"
+// object of the linux section) into a Filter for the given native architecture,
+// see [OCISeccomp.Filter].
+func ParseOCISeccomp(data []byte, arch string) (*Filter, error) {
+	var profile OCISeccomp
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return nil, err
+	}
+	return profile.Filter(arch)
+}
+
+// Filter converts the profile into a Filter for the given native architecture,
+// the other architectures of the profile become SecondaryArchitectures.
+//
+// When several rules match a syscall, the one with the highest priority action
+// decides as with libseccomp, from SCMP_ACT_KILL_PROCESS, SCMP_ACT_KILL_THREAD,
+// SCMP_ACT_TRAP, SCMP_ACT_ERRNO, SCMP_ACT_NOTIFY, SCMP_ACT_TRACE and SCMP_ACT_LOG
+// to SCMP_ACT_ALLOW, the first one in the profile order deciding between rules
+// of the same action. The supported flags are set in the Filter Flags.
+// Syscall names are resolved on each architecture of the profile, giving the
+// Elements on the native one, the ArchElements on the others and the X32Elements
+// of the X32Rules policy for SCMP_ARCH_X32. As with libseccomp, syscalls of other
+// architectures get the KillThread decision and syscall names unknown on an
+// architecture are ignored there, even if no architecture of the profile knows them.
+func (p *OCISeccomp) Filter(arch string) (*Filter, error) {
+	if !lowlevel.HasSyscallTable(arch) {
+		return nil, fmt.Errorf("no syscall table for architecture '%s'", arch)
+	}
+	var flags uint
+	for _, name := range p.Flags {
+		flag, err := ociFlag(name)
+		if err != nil {
+			return nil, err
+		}
+		flags |= flag
+	}
+	if p.ListenerPath != "" || p.ListenerMetadata != "" {
+		return nil, fmt.Errorf("listenerPath and listenerMetadata are not supported, use InsertWithListener")
+	}
+	defaultDecision, err := ociDecision(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, fmt.Errorf("defaultAction: %w", err)
+	}
+	filter := &Filter{
+		Architecture:    arch,
+		DefaultDecision: defaultDecision,
+		BadArchDecision: &Decision{Type: KillThread},
+		Flags:           flags,
+	}
+
+	x32 := false
+	for _, name := range p.Architectures {
+		if name == ociArchX32 {
+			x32 = true
+			continue
+		}
+		secondary, ok := ociArchitectures[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown architecture '%s'", name)
+		}
+		if secondary == arch {
+			continue
+		}
+		if lowlevel.ArchIsLittleEndian(secondary) != lowlevel.ArchIsLittleEndian(arch) {
+			return nil, fmt.Errorf(
+				"architecture '%s' endianness differs from '%s'",
+				name, arch,
+			)
+		}
+		filter.SecondaryArchitectures = append(filter.SecondaryArchitectures, secondary)
+	}
+	if x32 {
+		filter.X32Policy = X32Rules
+		hasAmd64 := arch == "amd64"
+		for _, secondary := range filter.SecondaryArchitectures {
+			hasAmd64 = hasAmd64 || secondary == "amd64"
+		}
+		if !hasAmd64 {
+			return nil, fmt.Errorf("architecture '%s' needs SCMP_ARCH_X86_64", ociArchX32)
+		}
+	}
+
+	rules := make([]ociRule, len(p.Syscalls))
+	for i, syscall := range p.Syscalls {
+		decision, err := ociDecision(syscall.Action, syscall.ErrnoRet)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		arguments, err := ociArguments(syscall.Args)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		rules[i] = ociRule{names: syscall.Names, decision: decision, arguments: arguments}
+		for _, table := range append([]string{arch}, filter.SecondaryArchitectures...) {
+			if err := rules[i].checkArguments(table); err != nil {
+				return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+			}
+		}
+	}
+	sortOCIRules(rules)
+	filter.Elements = ociElements(rules, arch)
+	for _, secondary := range filter.SecondaryArchitectures {
+		if filter.ArchElements == nil {
+			filter.ArchElements = make(map[string][]FilterElement)
+		}
+		filter.ArchElements[secondary] = ociElements(rules, secondary)
+	}
+	if x32 {
+		filter.X32Elements = ociElements(rules, "x32")
+	}
+	return filter, nil
+}
+
+// ociAction converts a Decision into a SCMP_ACT_* action and its errnoRet
+func ociAction(decision Decision) (string, *uint, error) {
+	var action string
+	switch decision.Type {
+	case Errno, Trace:
+		data := uint(decision.Data)
+		if decision.Type == Errno {
+			return "SCMP_ACT_ERRNO", &data, nil
+		}
+		return "SCMP_ACT_TRACE", &data, nil
+	case KillThread:
+		action = "SCMP_ACT_KILL_THREAD"
+	case KillProcess:
+		action = "SCMP_ACT_KILL_PROCESS"
+	case Trap:
+		action = "SCMP_ACT_TRAP"
+	case Allow:
+		action = "SCMP_ACT_ALLOW"
+	case Log:
+		action = "SCMP_ACT_LOG"
+	case UserNotify:
+		action = "SCMP_ACT_NOTIFY"
+	default:
+		return "", nil, fmt.Errorf("unknown decision type 0x%x", uint32(decision.Type))
+	}
+	if decision.Data != 0 {
+		return "", nil, fmt.Errorf("data of decision '%s' can't be expressed", action)
+	}
+	return action, nil, nil
+}
+
+// ociArchitecture returns the libseccomp name of a Go architecture
+func ociArchitecture(arch string) (string, error) {
+	for name, goArch := range ociArchitectures {
+		if goArch == arch {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("architecture '%s' has no libseccomp name", arch)
+}
+
+// ociArgs converts the argument checks of a SyscallCallFilter into conditions
+func ociArgs(args [6]SyscallArgument) []OCISeccompArg {
+	var conditions []OCISeccompArg
+	for i, arg := range args {
+		if arg.isAny {
+			continue
+		}
+		condition := OCISeccompArg{Index: uint(i), Value: uint64(arg.Value)}
+		switch arg.Op {
+		case OpEqual:
+			condition.Op = "SCMP_CMP_EQ"
+		case OpNotEqual:
+			condition.Op = "SCMP_CMP_NE"
+		case OpLessThan:
+			condition.Op = "SCMP_CMP_LT"
+		case OpLessOrEqual:
+			condition.Op = "SCMP_CMP_LE"
+		case OpGreaterThan:
+			condition.Op = "SCMP_CMP_GT"
+		case OpGreaterOrEqual:
+			condition.Op = "SCMP_CMP_GE"
+		case OpMaskedEqual:
+			condition.Op = "SCMP_CMP_MASKED_EQ"
+			condition.Value, condition.ValueTwo = uint64(arg.Mask), uint64(arg.Value)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions
+}
+
+// ToOCISeccomp converts the Filter into an OCI runtime-spec seccomp profile,
+// syscalls being named from the Architecture syscall table. Each FilterElement
+// gives a rule per distinct set of argument checks, in the Elements order.
+//
+// Rules of the ArchElements and of the X32Elements follow, for the syscalls
+// unknown on the Architecture only. As profile rules apply to every architecture,
+// an error is returned if the profile doesn't take the same decisions as the Filter.
+//
+// The BadArchDecision isn't part of the profile, runtimes using libseccomp
+// apply KillThread. They also don't apply rules in order but by action precedence,
+// so an error is returned for Filters where a rule with a lower priority decision
+// comes first and overlaps a rule taking another decision.
+func (f *Filter) ToOCISeccomp() (*OCISeccomp, error) {
+	defaultAction, defaultErrnoRet, err := ociAction(f.DefaultDecision)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultDecision: %w", err)
+	}
+	profile := &OCISeccomp{DefaultAction: defaultAction, DefaultErrnoRet: defaultErrnoRet}
+	if f.Flags&^filterFlags != 0 {
+		return nil, fmt.Errorf("flags 0x%x can't be expressed", f.Flags&^filterFlags)
+	}
+	for _, flag := range ociFlags {
+		if f.Flags&flag.flag != 0 {
+			profile.Flags = append(profile.Flags, flag.name)
+		}
+	}
+	for _, arch := range append([]string{f.Architecture}, f.SecondaryArchitectures...) {
+		name, err := ociArchitecture(arch)
+		if err != nil {
+			return nil, err
+		}
+		profile.Architectures = append(profile.Architectures, name)
+	}
+	switch f.X32Policy {
+	case X32Deny:
+	case X32Native, X32Rules:
+		profile.Architectures = append(profile.Architectures, ociArchX32)
+	default:
+		return nil, fmt.Errorf("x32 policy %d can't be expressed", f.X32Policy)
+	}
+
+	if err := profile.addRules(f.Elements, "Elements", f.Architecture, ""); err != nil {
+		return nil, err
+	}
+	for _, arch := range f.SecondaryArchitectures {
+		if elements, ok := f.ArchElements[arch]; ok {
+			list := fmt.Sprintf("ArchElements[%q]", arch)
+			if err := profile.addRules(elements, list, arch, f.Architecture); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if f.X32Policy == X32Rules {
+		if err := profile.addRules(f.X32Elements, "X32Elements", "x32", f.Architecture); err != nil {
+			return nil, err
+		}
+	}
+	imported, err := profile.Filter(f.Architecture)
+	if err != nil {
+		return nil, err
+	}
+	imported.BadArchDecision = f.BadArchDecision
+	difference, err := f.Equivalent(imported)
+	if err != nil {
+		return nil, err
+	}
+	if difference != nil {
+		return nil, fmt.Errorf(
+			"rules of the architectures differ and can't be expressed, decision on %+v would be '%+v'",
+			difference.Data, difference.Second,
+		)
+	}
+	return profile, nil
+}
+
+// addRules adds the rules of the elements numbered for the table architecture,
+// skipping the syscalls known on the skipped one if any.
+func (p *OCISeccomp) addRules(elements []FilterElement, list string, table string, skipped string) error {
+	for i, element := range elements {
+		action, errnoRet, err := ociAction(element.Decision)
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", list, i, err)
+		}
+		rules := make(map[[6]SyscallArgument]int)
+		for _, match := range element.Match {
+			name, ok := match.Name(table)
+			if !ok {
+				return fmt.Errorf(
+					"%s[%d]: syscall %d has no name on architecture '%s'",
+					list, i, match.Number, table,
+				)
+			}
+			if _, ok := lowlevel.SyscallNumber(skipped, name); ok {
+				continue
+			}
+			rule, ok := rules[match.Args]
+			if !ok {
+				rule = len(p.Syscalls)
+				rules[match.Args] = rule
+				p.Syscalls = append(p.Syscalls, OCISyscall{
+					Action:   action,
+					ErrnoRet: errnoRet,
+					Args:     ociArgs(match.Args),
+				})
+			}
+			p.Syscalls[rule].Names = append(p.Syscalls[rule].Names, name)
+		}
+	}
+	return nil
+}
+
+// MarshalOCISeccomp converts the Filter into an OCI runtime-spec seccomp profile
+// JSON document, see [Filter.ToOCISeccomp].
+func (f *Filter) MarshalOCISeccomp() ([]byte, error) {
+	profile, err := f.ToOCISeccomp()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(profile, "", "\t")
+}
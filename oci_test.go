@@ -0,0 +1,449 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+const ociProfile = `{
+	"defaultAction": "SCMP_ACT_ERRNO",
+	"defaultErrnoRet": 38,
+	"architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"],
+	"syscalls": [
+		{
+			"names": ["read", "write", "not_a_syscall"],
+			"action": "SCMP_ACT_ALLOW"
+		},
+		{
+			"names": ["personality"],
+			"action": "SCMP_ACT_ALLOW",
+			"args": [
+				{"index": 0, "value": 0, "op": "SCMP_CMP_EQ"},
+				{"index": 0, "value": 8, "op": "SCMP_CMP_EQ"}
+			]
+		},
+		{
+			"names": ["clone"],
+			"action": "SCMP_ACT_ERRNO",
+			"args": [
+				{"index": 0, "value": 2114060288, "valueTwo": 0, "op": "SCMP_CMP_MASKED_EQ"},
+				{"index": 1, "value": 16, "op": "SCMP_CMP_GT"}
+			]
+		},
+		{
+			"names": ["ptrace"],
+			"action": "SCMP_ACT_KILL"
+		}
+	]
+}`
+
+func TestParseOCISeccomp(t *testing.T) {
+	filter, err := ParseOCISeccomp([]byte(ociProfile), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anyArgs := [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}
+	withArg := func(index int, arg SyscallArgument) [6]SyscallArgument {
+		args := anyArgs
+		args[index] = arg
+		return args
+	}
+	cloneArgs := withArg(0, MaskedEqual(2114060288, 0))
+	cloneArgs[1] = GreaterThan(16)
+	// Names are resolved on each architecture
+	elements := func(table string) []FilterElement {
+		number := func(name string) uint {
+			number, ok := lowlevel.SyscallNumber(table, name)
+			if !ok {
+				t.Fatalf("no %s syscall on %s", name, table)
+			}
+			return number
+		}
+		// Rules are ordered by action precedence
+		return []FilterElement{
+			{
+				Match:    []SyscallCallFilter{{Number: number("ptrace"), Args: anyArgs}},
+				Decision: Decision{Type: KillThread},
+			},
+			{
+				Match:    []SyscallCallFilter{{Number: number("clone"), Args: cloneArgs}},
+				Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)},
+			},
+			{
+				Match: []SyscallCallFilter{
+					{Number: number("read"), Args: anyArgs},
+					{Number: number("write"), Args: anyArgs},
+				},
+				Decision: Decision{Type: Allow},
+			},
+			{
+				Match: []SyscallCallFilter{
+					{Number: number("personality"), Args: withArg(0, Equal(0))},
+					{Number: number("personality"), Args: withArg(0, Equal(8))},
+				},
+				Decision: Decision{Type: Allow},
+			},
+		}
+	}
+	expected := &Filter{
+		Architecture:           "amd64",
+		SecondaryArchitectures: []string{"386"},
+		ArchElements:           map[string][]FilterElement{"386": elements("386")},
+		X32Policy:              X32Rules,
+		X32Elements:            elements("x32"),
+		DefaultDecision:        Decision{Type: Errno, Data: uint16(unix.ENOSYS)},
+		BadArchDecision:        &Decision{Type: KillThread},
+		Elements:               elements("amd64"),
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("\n\tExpected: %+v\n\tGot:      %+v", expected, filter)
+	}
+	if _, err := filter.compile(); err != nil {
+		t.Errorf("Unexpected compilation error: %v", err)
+	}
+}
+
+type TestCasesOCIArguments struct {
+	args     []OCISeccompArg
+	expected [][6]SyscallArgument
+}
+
+func TestOCIArguments(t *testing.T) {
+	eq := func(index uint, value uint64) OCISeccompArg {
+		return OCISeccompArg{Index: index, Value: value, Op: "SCMP_CMP_EQ"}
+	}
+	args := func(a0, a1, a2 SyscallArgument) [6]SyscallArgument {
+		return [6]SyscallArgument{a0, a1, a2, Any(), Any(), Any()}
+	}
+	cases := []TestCasesOCIArguments{
+		{nil, [][6]SyscallArgument{args(Any(), Any(), Any())}},
+		{
+			[]OCISeccompArg{eq(0, 1), eq(1, 5)},
+			[][6]SyscallArgument{args(Equal(1), Equal(5), Any())},
+		},
+		{
+			[]OCISeccompArg{eq(0, 1), eq(0, 2)},
+			[][6]SyscallArgument{args(Equal(1), Any(), Any()), args(Equal(2), Any(), Any())},
+		},
+		// As soon as an argument has several conditions, each condition is an alternative
+		{
+			[]OCISeccompArg{eq(0, 1), eq(0, 2), eq(1, 5), eq(2, 6)},
+			[][6]SyscallArgument{
+				args(Equal(1), Any(), Any()),
+				args(Equal(2), Any(), Any()),
+				args(Any(), Equal(5), Any()),
+				args(Any(), Any(), Equal(6)),
+			},
+		},
+		{
+			[]OCISeccompArg{eq(1, 5), eq(0, 1), eq(2, 7), eq(0, 2), eq(2, 8)},
+			[][6]SyscallArgument{
+				args(Any(), Equal(5), Any()),
+				args(Equal(1), Any(), Any()),
+				args(Any(), Any(), Equal(7)),
+				args(Equal(2), Any(), Any()),
+				args(Any(), Any(), Equal(8)),
+			},
+		},
+	}
+	for i, tc := range cases {
+		got, err := ociArguments(tc.args)
+		if err != nil {
+			t.Errorf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("[%d/%d] Expected '%+v' got '%+v'", i+1, len(cases), tc.expected, got)
+		}
+	}
+}
+
+type TestCasesParseOCISeccompMixedArguments struct {
+	args     [3]uint64
+	expected Decision
+}
+
+func TestParseOCISeccompMixedArguments(t *testing.T) {
+	profile := `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"syscalls": [{
+			"names": ["read"],
+			"action": "SCMP_ACT_ALLOW",
+			"args": [
+				{"index": 0, "value": 1, "op": "SCMP_CMP_EQ"},
+				{"index": 0, "value": 2, "op": "SCMP_CMP_EQ"},
+				{"index": 1, "value": 5, "op": "SCMP_CMP_EQ"},
+				{"index": 2, "value": 6, "op": "SCMP_CMP_EQ"}
+			]
+		}]
+	}`
+	filter, err := ParseOCISeccomp([]byte(profile), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := filter.Compile()
+	if err != nil {
+		t.Skipf("Failed to compile, skipping")
+	}
+	cases := []TestCasesParseOCISeccompMixedArguments{
+		{[3]uint64{1, 5, 6}, Decision{Type: Allow}},
+		{[3]uint64{2, 0, 0}, Decision{Type: Allow}},
+		{[3]uint64{9, 5, 0}, Decision{Type: Allow}},
+		{[3]uint64{9, 0, 6}, Decision{Type: Allow}},
+		{[3]uint64{9, 0, 0}, filter.DefaultDecision},
+	}
+	for i, tc := range cases {
+		data := lowlevel.SeccompData{
+			Number: unix.SYS_READ,
+			Arch:   lowlevel.GetAuditArch("amd64"),
+			Arg0:   tc.args[0],
+			Arg1:   tc.args[1],
+			Arg2:   tc.args[2],
+		}
+		got, err := Evaluate(program, data, "amd64")
+		if err != nil || got != tc.expected {
+			t.Errorf("[%d/%d] Expected '%+v' got '%+v' (%v)", i+1, len(cases), tc.expected, got, err)
+		}
+	}
+}
+
+type TestCasesParseOCISeccompSecondaryNames struct {
+	arch     string
+	syscall  string
+	expected Decision
+}
+
+func TestParseOCISeccompSecondaryNames(t *testing.T) {
+	profile := `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86"],
+		"syscalls": [{"names": ["mmap", "mmap2"], "action": "SCMP_ACT_ALLOW"}]
+	}`
+	filter, err := ParseOCISeccomp([]byte(profile), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := filter.Compile()
+	if err != nil {
+		t.Skipf("Failed to compile, skipping")
+	}
+	// mmap2 only exists on 386, where mmap is the old_mmap syscall
+	cases := []TestCasesParseOCISeccompSecondaryNames{
+		{"amd64", "mmap", Decision{Type: Allow}},
+		{"386", "mmap", Decision{Type: Allow}},
+		{"386", "mmap2", Decision{Type: Allow}},
+		{"386", "read", filter.DefaultDecision},
+	}
+	for i, tc := range cases {
+		number, ok := lowlevel.SyscallNumber(tc.arch, tc.syscall)
+		if !ok {
+			t.Fatalf("no %s syscall on %s", tc.syscall, tc.arch)
+		}
+		data := lowlevel.SeccompData{Number: int32(number), Arch: lowlevel.GetAuditArch(tc.arch)}
+		got, err := Evaluate(program, data, "amd64")
+		if err != nil || got != tc.expected {
+			t.Errorf("[%d/%d] Expected '%+v' got '%+v' (%v)", i+1, len(cases), tc.expected, got, err)
+		}
+	}
+
+	exported, err := filter.ToOCISeccomp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []OCISyscall{
+		{Names: []string{"mmap"}, Action: "SCMP_ACT_ALLOW"},
+		{Names: []string{"mmap2"}, Action: "SCMP_ACT_ALLOW"},
+	}
+	if !reflect.DeepEqual(exported.Syscalls, expected) {
+		t.Errorf("\n\tExpected: %+v\n\tGot:      %+v", expected, exported.Syscalls)
+	}
+}
+
+type TestCasesParseOCISeccompErrors struct {
+	arch    string
+	profile string
+	err     string
+}
+
+func TestParseOCISeccompErrors(t *testing.T) {
+	cases := []TestCasesParseOCISeccompErrors{
+		{"amd64", `{"defaultAction": "SCMP_ACT_NOPE"}`, "unknown action 'SCMP_ACT_NOPE'"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "defaultErrnoRet": 1}`, "errnoRet can't be used"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ERRNO", "defaultErrnoRet": 65536}`, "errnoRet 65536 out of range"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_VAX"]}`, "unknown architecture 'SCMP_ARCH_VAX'"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_S390X"]}`, "endianness"},
+		{"arm64", `{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_X32"]}`, "needs SCMP_ARCH_X86_64"},
+		{"vax", `{"defaultAction": "SCMP_ACT_ALLOW"}`, "no syscall table for architecture 'vax'"},
+		{
+			"amd64",
+			`{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86"], "syscalls": [{"names": ["read"], "action": "SCMP_ACT_KILL", "args": [{"index": 0, "value": 4294967296, "op": "SCMP_CMP_LT"}]}]}`,
+			"syscalls[0]: argument 0 value doesn't fit",
+		},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "flags": ["SECCOMP_FILTER_FLAG_LOG", "SECCOMP_FILTER_FLAG_TSYNC"]}`, "flag 'SECCOMP_FILTER_FLAG_TSYNC' not supported"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "listenerPath": "/run/seccomp.sock"}`, "listenerPath"},
+		{"amd64", `{"defaultAction": "SCMP_ACT_ALLOW", "unknown": true}`, "unknown field"},
+		{
+			"amd64",
+			`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_KILL", "args": [{"index": 6, "value": 0, "op": "SCMP_CMP_EQ"}]}]}`,
+			"syscalls[0]: argument index 6 out of range",
+		},
+		{
+			"amd64",
+			`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_KILL", "args": [{"index": 0, "value": 0, "op": "SCMP_CMP_LIKE"}]}]}`,
+			"syscalls[0]: unknown operator 'SCMP_CMP_LIKE'",
+		},
+	}
+	for i, tc := range cases {
+		_, err := ParseOCISeccomp([]byte(tc.profile), tc.arch)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf(
+				"[%d/%d] Expected error containing '%s' got '%v'",
+				i+1, len(cases),
+				tc.err,
+				err,
+			)
+		}
+	}
+}
+
+func TestParseOCISeccompPrecedence(t *testing.T) {
+	profile := `{
+		"defaultAction": "SCMP_ACT_ALLOW",
+		"flags": ["SECCOMP_FILTER_FLAG_LOG", "SECCOMP_FILTER_FLAG_SPEC_ALLOW"],
+		"syscalls": [
+			{"names": ["read"], "action": "SCMP_ACT_LOG"},
+			{"names": ["read"], "action": "SCMP_ACT_ERRNO", "errnoRet": 1, "args": [{"index": 0, "value": 3, "op": "SCMP_CMP_EQ"}]},
+			{"names": ["read"], "action": "SCMP_ACT_ERRNO", "errnoRet": 2, "args": [{"index": 0, "value": 4, "op": "SCMP_CMP_LE"}]},
+			{"names": ["read"], "action": "SCMP_ACT_KILL_PROCESS", "args": [{"index": 0, "value": 4, "op": "SCMP_CMP_EQ"}]}
+		]
+	}`
+	filter, err := ParseOCISeccomp([]byte(profile), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Flags != lowlevel.SECCOMP_FILTER_FLAG_LOG|lowlevel.SECCOMP_FILTER_FLAG_SPEC_ALLOW {
+		t.Errorf("Unexpected flags 0x%x", filter.Flags)
+	}
+	// The highest priority action decides, then the first rule in the profile
+	expected := map[uint64]Decision{
+		3: {Type: Errno, Data: 1},
+		2: {Type: Errno, Data: 2},
+		4: {Type: KillProcess},
+		5: {Type: Log},
+	}
+	for arg0, decision := range expected {
+		data := lowlevel.SeccompData{Number: unix.SYS_READ, Arch: lowlevel.GetAuditArch("amd64"), Arg0: arg0}
+		got, err := filter.Explain(data)
+		if err != nil || got.Decision != decision {
+			t.Errorf("read(%d): Expected '%+v' got '%+v' (%v)", arg0, decision, got.Decision, err)
+		}
+	}
+}
+
+func TestMarshalOCISeccompRoundTrip(t *testing.T) {
+	imported, err := ParseOCISeccomp([]byte(ociProfile), "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := imported.MarshalOCISeccomp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reimported, err := ParseOCISeccomp(exported, "amd64")
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, exported)
+	}
+	difference, err := imported.Equivalent(reimported)
+	if err != nil || difference != nil {
+		t.Errorf("Expected equivalent filters, got %+v (%v)", difference, err)
+	}
+	reexported, err := reimported.MarshalOCISeccomp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reexported) != string(exported) {
+		t.Errorf("\n\tExpected: %s\n\tGot:      %s", exported, reexported)
+	}
+}
+
+func TestFilterToOCISeccomp(t *testing.T) {
+	read, err := NewSyscallCallFilter("arm64", "read", Any(), MaskedEqual(0xf0, 0x10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write, err := NewSyscallCallFilter("arm64", "write", Any(), MaskedEqual(0xf0, 0x10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getpid, err := NewSyscallCallFilter("arm64", "getpid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := Filter{
+		Architecture:           "arm64",
+		SecondaryArchitectures: []string{"arm"},
+		Elements: []FilterElement{
+			{Match: []SyscallCallFilter{read, getpid, write}, Decision: Decision{Type: Allow}},
+		},
+		DefaultDecision: Decision{Type: KillProcess},
+	}
+	profile, err := filter.ToOCISeccomp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &OCISeccomp{
+		DefaultAction: "SCMP_ACT_KILL_PROCESS",
+		Architectures: []string{"SCMP_ARCH_AARCH64", "SCMP_ARCH_ARM"},
+		Syscalls: []OCISyscall{
+			{
+				Names:  []string{"read", "write"},
+				Action: "SCMP_ACT_ALLOW",
+				Args:   []OCISeccompArg{{Index: 1, Value: 0xf0, ValueTwo: 0x10, Op: "SCMP_CMP_MASKED_EQ"}},
+			},
+			{Names: []string{"getpid"}, Action: "SCMP_ACT_ALLOW"},
+		},
+	}
+	if !reflect.DeepEqual(profile, expected) {
+		t.Errorf("\n\tExpected: %+v\n\tGot:      %+v", expected, profile)
+	}
+
+	filter.X32Policy = X32Rules
+	if _, err := filter.ToOCISeccomp(); err == nil {
+		t.Errorf("Expected an error for the X32Rules policy")
+	}
+	filter.X32Policy = X32Deny
+	filter.ArchElements = map[string][]FilterElement{"arm": nil}
+	if _, err := filter.ToOCISeccomp(); err == nil {
+		t.Errorf("Expected an error for ArchElements differing from the Elements")
+	}
+	filter.ArchElements = nil
+	filter.Flags = lowlevel.SECCOMP_FILTER_FLAG_LOG
+	profile, err = filter.ToOCISeccomp()
+	if err != nil || !reflect.DeepEqual(profile.Flags, []string{"SECCOMP_FILTER_FLAG_LOG"}) {
+		t.Errorf("Expected the SECCOMP_FILTER_FLAG_LOG flag, got %+v (%v)", profile, err)
+	}
+	filter.Flags = lowlevel.SECCOMP_FILTER_FLAG_TSYNC
+	if _, err := filter.ToOCISeccomp(); err == nil {
+		t.Errorf("Expected an error for the SECCOMP_FILTER_FLAG_TSYNC flag")
+	}
+	filter.Flags = 0
+	// Runtimes apply the Trap decision first
+	filter.Elements = append(filter.Elements, FilterElement{
+		Match:    []SyscallCallFilter{getpid},
+		Decision: Decision{Type: Trap},
+	})
+	if _, err := filter.ToOCISeccomp(); err == nil {
+		t.Errorf("Expected an error for a shadowed higher priority decision")
+	}
+	filter.Elements = filter.Elements[:1]
+	filter.Elements[0].Decision = Decision{Type: Trap, Data: 1}
+	if _, err := filter.ToOCISeccomp(); err == nil {
+		t.Errorf("Expected an error for a Trap decision with data")
+	}
+}
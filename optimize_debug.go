@@ -0,0 +1,9 @@
+// SPDX-Licence-Identifier: MIT
+
+//go:build goseccomp_debug
+
+package goseccomp
+
+// debugOptimize makes Optimize check that its semantics preserving passes
+// don't change the Filter decisions.
+const debugOptimize = true
@@ -0,0 +1,7 @@
+// SPDX-Licence-Identifier: MIT
+
+//go:build !goseccomp_debug
+
+package goseccomp
+
+const debugOptimize = false
@@ -0,0 +1,147 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+)
+
+// pfcWriter writes indented pseudo filter code lines
+type pfcWriter struct {
+	*bufio.Writer
+}
+
+func (w pfcWriter) line(depth int, format string, args ...interface{}) {
+	w.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(w, format, args...)
+	w.WriteByte('\n')
+}
+
+// pfcArchName returns the libseccomp name of an architecture
+func pfcArchName(arch string) string {
+	if arch == "x32" {
+		return "x32"
+	}
+	if name, err := ociArchitecture(arch); err == nil {
+		return strings.ToLower(strings.TrimPrefix(name, "SCMP_ARCH_"))
+	}
+	return arch
+}
+
+// pfcAction returns the libseccomp pseudo filter code of a Decision
+func pfcAction(decision Decision) string {
+	switch decision.Type {
+	case Allow:
+		return "ALLOW"
+	case KillProcess:
+		return "KILL_PROCESS"
+	case KillThread:
+		return "KILL"
+	case Errno:
+		return fmt.Sprintf("ERRNO(%d)", decision.Data)
+	case Trap:
+		return "TRAP"
+	case Trace:
+		return fmt.Sprintf("TRACE(%d)", decision.Data)
+	case Log:
+		return "LOG"
+	case UserNotify:
+		return "NOTIFY"
+	default:
+		return fmt.Sprintf("0x%08x", decision.ToUint32())
+	}
+}
+
+// pfcCondition returns the pseudo filter code of an argument check
+func (a SyscallArgument) pfcCondition(index int) string {
+	if a.Op == OpMaskedEqual {
+		return fmt.Sprintf("($a%d & %#x) == %#x", index, uint64(a.Mask), uint64(a.Value))
+	}
+	return fmt.Sprintf("$a%d %v %#x", index, a.Op, uint64(a.Value))
+}
+
+// writePFCElements writes the rules of the elements, numbered for the table arch,
+// followed by the default action. list names the Filter field of the elements.
+func (f *Filter) writePFCElements(w pfcWriter, depth int, list string, elements []FilterElement, table string) {
+	for i, element := range elements {
+		w.line(depth, "# %s[%d]", list, i)
+		for _, match := range element.Match {
+			name, ok := match.Name(table)
+			if !ok {
+				name = "?"
+			}
+			w.line(depth, "# filter for syscall \"%s\" (%d)", name, match.Number)
+			w.line(depth, "if ($syscall == %d)", match.Number)
+			argsDepth := depth + 1
+			for index, arg := range match.Args {
+				if arg.isAny {
+					continue
+				}
+				w.line(argsDepth, "if (%s)", arg.pfcCondition(index))
+				argsDepth++
+			}
+			w.line(argsDepth, "action %s;", pfcAction(element.Decision))
+		}
+	}
+	w.line(depth, "# default action")
+	w.line(depth, "action %s;", pfcAction(f.DefaultDecision))
+}
+
+// ExportPFC writes the Filter as human readable pseudo filter code, in the
+// fashion of libseccomp's seccomp_export_pfc. Rules are written in the Filter
+// order, the first matching one deciding, so the output reflects whether the
+// Filter has been optimized or not. As with Compile, argument values wider than
+// 32 bits are refused on 32 bits architectures.
+func (f *Filter) ExportPFC(out io.Writer) error {
+	w := pfcWriter{bufio.NewWriter(out)}
+	w.line(0, "#")
+	w.line(0, "# pseudo filter code start")
+	w.line(0, "#")
+	for _, arch := range append([]string{f.Architecture}, f.SecondaryArchitectures...) {
+		elements, err := f.elementsFor(arch)
+		if err != nil {
+			return err
+		}
+		if err := checkArguments(elements, arch); err != nil {
+			return err
+		}
+		auditArch := lowlevel.GetAuditArch(arch)
+		if auditArch == 0 {
+			return fmt.Errorf("unknown architecture '%s'", arch)
+		}
+		w.line(0, "# filter for arch %s (%d)", pfcArchName(arch), auditArch)
+		w.line(0, "if ($arch == %d)", auditArch)
+		if arch == "amd64" {
+			w.line(1, "# filter for arch x32")
+			w.line(1, "if ($syscall & %#x)", lowlevel.X32_SYSCALL_BIT)
+			switch f.X32Policy {
+			case X32Native:
+				elements, err := f.elementsFor("x32")
+				if err != nil {
+					return err
+				}
+				f.writePFCElements(w, 2, "Elements", elements, "x32")
+			case X32Rules:
+				f.writePFCElements(w, 2, "X32Elements", f.X32Elements, "x32")
+			default:
+				w.line(2, "action %s;", pfcAction(f.badArchDecision()))
+			}
+		}
+		list := "Elements"
+		if _, ok := f.ArchElements[arch]; ok && arch != f.Architecture {
+			list = fmt.Sprintf("ArchElements[%q]", arch)
+		}
+		f.writePFCElements(w, 1, list, elements, arch)
+	}
+	w.line(0, "# invalid architecture action")
+	w.line(0, "action %s;", pfcAction(f.badArchDecision()))
+	w.line(0, "#")
+	w.line(0, "# pseudo filter code end")
+	w.line(0, "#")
+	return w.Flush()
+}
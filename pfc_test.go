@@ -0,0 +1,88 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterExportPFC(t *testing.T) {
+	read, err := NewSyscallCallFilter("arm64", "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmap, err := NewSyscallCallFilter("arm64", "mmap", Any(), LessThan(value64(t, 0x100000001)), MaskedEqual(0x4, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mmap2, err := NewSyscallCallFilter("arm", "mmap2", Any(), LessThan(0x1), MaskedEqual(0x4, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := Filter{
+		Architecture:           "arm64",
+		SecondaryArchitectures: []string{"arm"},
+		Elements: []FilterElement{
+			{Match: []SyscallCallFilter{read}, Decision: Decision{Type: Allow}},
+			{Match: []SyscallCallFilter{mmap}, Decision: Decision{Type: Errno, Data: 1}},
+		},
+		ArchElements: map[string][]FilterElement{
+			"arm": {
+				{Match: []SyscallCallFilter{{Number: 3, Args: anyArgs()}}, Decision: Decision{Type: Allow}},
+				// No mmap on arm
+				{Match: []SyscallCallFilter{mmap2}, Decision: Decision{Type: Errno, Data: 1}},
+			},
+		},
+		DefaultDecision: Decision{Type: Trace, Data: 7},
+	}
+	expected := `#
+# pseudo filter code start
+#
+# filter for arch aarch64 (3221225655)
+if ($arch == 3221225655)
+  # Elements[0]
+  # filter for syscall "read" (63)
+  if ($syscall == 63)
+    action ALLOW;
+  # Elements[1]
+  # filter for syscall "mmap" (222)
+  if ($syscall == 222)
+    if ($a1 < 0x100000001)
+      if (($a2 & 0x4) == 0x0)
+        action ERRNO(1);
+  # default action
+  action TRACE(7);
+# filter for arch arm (1073741864)
+if ($arch == 1073741864)
+  # ArchElements["arm"][0]
+  # filter for syscall "read" (3)
+  if ($syscall == 3)
+    action ALLOW;
+  # ArchElements["arm"][1]
+  # filter for syscall "mmap2" (192)
+  if ($syscall == 192)
+    if ($a1 < 0x1)
+      if (($a2 & 0x4) == 0x0)
+        action ERRNO(1);
+  # default action
+  action TRACE(7);
+# invalid architecture action
+action KILL_PROCESS;
+#
+# pseudo filter code end
+#
+`
+	var got strings.Builder
+	if err := filter.ExportPFC(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != expected {
+		t.Errorf("\n\tExpected:\n%s\n\tGot:\n%s", expected, got.String())
+	}
+
+	filter.ArchElements["arm"][1].Match[0].Args = mmap.Args
+	if err := filter.ExportPFC(&got); err == nil || !strings.Contains(err.Error(), "doesn't fit in 32 bits") {
+		t.Errorf("Expected a wide argument error on arm, got %v", err)
+	}
+}
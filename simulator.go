@@ -0,0 +1,170 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// decisionFromReturn converts a seccomp program return value into the Decision
+// taken by the kernel, which treats unknown actions as KillProcess.
+func decisionFromReturn(ret uint32) Decision {
+	decision := Decision{Type: DecisionType(ret & 0xffff0000), Data: uint16(ret)}
+	switch decision.Type {
+	case Allow, KillProcess, KillThread, Errno, Trap, Trace, Log, UserNotify:
+		return decision
+	default:
+		return Decision{Type: KillProcess}
+	}
+}
+
+// Evaluate runs a compiled seccomp program, as returned by [Filter.Compile], against
+// the given seccomp data without inserting it, and returns the resulting Decision.
+// arch is the architecture the program runs on, it gives the seccomp data endianness.
+//
+// Evaluate returns an error if the program would be refused by the kernel, or
+// doesn't return a value.
+func Evaluate(program []bpf.RawInstruction, data lowlevel.SeccompData, arch string) (Decision, error) {
+	if lowlevel.GetAuditArch(arch) == 0 {
+		return Decision{}, fmt.Errorf("unknown architecture '%s'", arch)
+	}
+	if len(program) == 0 || len(program) > lowlevel.BPF_MAXINSNS {
+		return Decision{}, fmt.Errorf("invalid program length %d", len(program))
+	}
+	instructions, allDecoded := bpf.Disassemble(program)
+	if !allDecoded {
+		return Decision{}, fmt.Errorf("program contains unknown instructions")
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if lowlevel.ArchIsLittleEndian(arch) {
+		order = binary.LittleEndian
+	}
+	input := data.Bytes(arch)
+
+	var a, x uint32
+	var scratch [16]uint32
+	for pc := 0; pc < len(instructions); pc++ {
+		switch instruction := instructions[pc].(type) {
+		case bpf.LoadAbsolute:
+			if instruction.Size != 4 || instruction.Off%4 != 0 || instruction.Off >= uint32(len(input)) {
+				return Decision{}, fmt.Errorf("instruction %d: invalid seccomp data load %+v", pc, instruction)
+			}
+			a = order.Uint32(input[instruction.Off:])
+		case bpf.LoadExtension:
+			// The only extension the kernel accepts, as the seccomp data size
+			if instruction.Num != bpf.ExtLen {
+				return Decision{}, fmt.Errorf("instruction %d: %T not allowed in seccomp programs", pc, instruction)
+			}
+			a = uint32(len(input))
+		case bpf.LoadConstant:
+			if instruction.Dst == bpf.RegA {
+				a = instruction.Val
+			} else {
+				x = instruction.Val
+			}
+		case bpf.LoadScratch:
+			if instruction.N >= len(scratch) {
+				return Decision{}, fmt.Errorf("instruction %d: invalid scratch slot %d", pc, instruction.N)
+			}
+			if instruction.Dst == bpf.RegA {
+				a = scratch[instruction.N]
+			} else {
+				x = scratch[instruction.N]
+			}
+		case bpf.StoreScratch:
+			if instruction.N >= len(scratch) {
+				return Decision{}, fmt.Errorf("instruction %d: invalid scratch slot %d", pc, instruction.N)
+			}
+			if instruction.Src == bpf.RegA {
+				scratch[instruction.N] = a
+			} else {
+				scratch[instruction.N] = x
+			}
+		case bpf.ALUOpConstant:
+			if (instruction.Op == bpf.ALUOpDiv || instruction.Op == bpf.ALUOpMod) && instruction.Val == 0 {
+				return Decision{}, fmt.Errorf("instruction %d: division by zero", pc)
+			}
+			a = aluOp(instruction.Op, a, instruction.Val)
+		case bpf.ALUOpX:
+			if (instruction.Op == bpf.ALUOpDiv || instruction.Op == bpf.ALUOpMod) && x == 0 {
+				// The program is aborted and returns 0
+				return decisionFromReturn(0), nil
+			}
+			a = aluOp(instruction.Op, a, x)
+		case bpf.NegateA:
+			a = -a
+		case bpf.TAX:
+			x = a
+		case bpf.TXA:
+			a = x
+		case bpf.Jump:
+			pc += int(instruction.Skip)
+		case bpf.JumpIf:
+			pc += jumpSkip(instruction.Cond, a, instruction.Val, instruction.SkipTrue, instruction.SkipFalse)
+		case bpf.JumpIfX:
+			pc += jumpSkip(instruction.Cond, a, x, instruction.SkipTrue, instruction.SkipFalse)
+		case bpf.RetA:
+			return decisionFromReturn(a), nil
+		case bpf.RetConstant:
+			return decisionFromReturn(instruction.Val), nil
+		default:
+			return Decision{}, fmt.Errorf("instruction %d: %T not allowed in seccomp programs", pc, instruction)
+		}
+	}
+	return Decision{}, fmt.Errorf("program ends without returning")
+}
+
+func aluOp(op bpf.ALUOp, a uint32, value uint32) uint32 {
+	switch op {
+	case bpf.ALUOpAdd:
+		return a + value
+	case bpf.ALUOpSub:
+		return a - value
+	case bpf.ALUOpMul:
+		return a * value
+	case bpf.ALUOpDiv:
+		return a / value
+	case bpf.ALUOpOr:
+		return a | value
+	case bpf.ALUOpAnd:
+		return a & value
+	case bpf.ALUOpShiftLeft:
+		return a << (value & 31)
+	case bpf.ALUOpShiftRight:
+		return a >> (value & 31)
+	case bpf.ALUOpMod:
+		return a % value
+	default:
+		return a ^ value
+	}
+}
+
+func jumpSkip(cond bpf.JumpTest, a uint32, value uint32, skipTrue uint8, skipFalse uint8) int {
+	var result bool
+	switch cond {
+	case bpf.JumpEqual:
+		result = a == value
+	case bpf.JumpNotEqual:
+		result = a != value
+	case bpf.JumpGreaterThan:
+		result = a > value
+	case bpf.JumpLessThan:
+		result = a < value
+	case bpf.JumpGreaterOrEqual:
+		result = a >= value
+	case bpf.JumpLessOrEqual:
+		result = a <= value
+	case bpf.JumpBitsSet:
+		result = a&value != 0
+	case bpf.JumpBitsNotSet:
+		result = a&value == 0
+	}
+	if result {
+		return int(skipTrue)
+	}
+	return int(skipFalse)
+}
@@ -0,0 +1,173 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func simulatedFilter(t *testing.T, arch string, secondary ...string) []bpf.RawInstruction {
+	read, err := NewSyscallCallFilter(arch, "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	getpgid, err := NewSyscallCallFilter(arch, "getpgid", GreaterThan(0x10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := Filter{
+		Architecture:           arch,
+		SecondaryArchitectures: secondary,
+		Elements: []FilterElement{
+			{Match: []SyscallCallFilter{read}, Decision: Decision{Type: Allow}},
+			{Match: []SyscallCallFilter{getpgid}, Decision: Decision{Type: Errno, Data: uint16(unix.EPERM)}},
+		},
+		DefaultDecision: Decision{Type: Errno, Data: uint16(unix.ENOSYS)},
+		BadArchDecision: &Decision{Type: Trap},
+	}
+	program, err := filter.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+type TestCasesEvaluate struct {
+	arch     string
+	dataArch string
+	syscall  string
+	number   uint
+	arg0     uint64
+	expected Decision
+}
+
+func TestEvaluate(t *testing.T) {
+	allow := Decision{Type: Allow}
+	eperm := Decision{Type: Errno, Data: uint16(unix.EPERM)}
+	enosys := Decision{Type: Errno, Data: uint16(unix.ENOSYS)}
+	trap := Decision{Type: Trap}
+	cases := []TestCasesEvaluate{
+		{"amd64", "amd64", "read", 0, 0, allow},
+		{"amd64", "amd64", "getpgid", 0, 0x11, eperm},
+		{"amd64", "amd64", "getpgid", 0, 0x10, enosys},
+		{"amd64", "amd64", "getpgid", 0, 0x100000000, eperm},
+		{"amd64", "amd64", "", lowlevel.X32_SYSCALL_BIT, 0, trap},
+		{"amd64", "386", "read", 0, 0, trap},
+		{"s390x", "s390x", "read", 0, 0, allow},
+		{"s390x", "s390x", "getpgid", 0, 0x11, eperm},
+		{"s390x", "s390x", "getpgid", 0, 0x100000000, eperm},
+		{"s390x", "s390x", "getpgid", 0, 0x1, enosys},
+		{"386", "386", "getpgid", 0, 0x11, eperm},
+		{"386", "386", "getpgid", 0, 0x100000000, enosys},
+		{"arm64", "arm64", "getpgid", 0, 0x11, eperm},
+		{"arm64", "arm", "getpgid", 0, 0x11, eperm},
+		{"arm64", "arm", "read", 0, 0, allow},
+		{"arm64", "arm", "getpid", 0, 0, enosys},
+		{"arm64", "386", "read", 0, 0, trap},
+	}
+	for i, tc := range cases {
+		var program []bpf.RawInstruction
+		if tc.arch == "arm64" {
+			program = simulatedFilter(t, tc.arch, "arm")
+		} else {
+			program = simulatedFilter(t, tc.arch)
+		}
+		number := tc.number
+		if tc.syscall != "" {
+			var ok bool
+			number, ok = lowlevel.SyscallNumber(tc.dataArch, tc.syscall)
+			if !ok {
+				t.Fatalf("[%d/%d] unknown syscall %s", i+1, len(cases), tc.syscall)
+			}
+		}
+		data := lowlevel.SeccompData{
+			Number: int32(number),
+			Arch:   lowlevel.GetAuditArch(tc.dataArch),
+			Arg0:   tc.arg0,
+		}
+		got, err := Evaluate(program, data, tc.arch)
+		if err != nil {
+			t.Errorf("[%d/%d] Unexpected error: %v", i+1, len(cases), err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf(
+				"[%d/%d] %s on %s: Expected '%+v' got '%+v'",
+				i+1, len(cases),
+				tc.syscall, tc.dataArch,
+				tc.expected,
+				got,
+			)
+		}
+	}
+}
+
+type TestCasesEvaluateProgram struct {
+	program  []bpf.Instruction
+	expected Decision
+	err      bool
+}
+
+func TestEvaluateProgram(t *testing.T) {
+	cases := []TestCasesEvaluateProgram{
+		{[]bpf.Instruction{bpf.RetConstant{Val: 0x12345678}}, Decision{Type: KillProcess}, false},
+		{
+			[]bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegA, Val: 5},
+				bpf.StoreScratch{Src: bpf.RegA, N: 3},
+				bpf.LoadConstant{Dst: bpf.RegX, Val: 7},
+				bpf.ALUOpX{Op: bpf.ALUOpAdd},
+				bpf.LoadScratch{Dst: bpf.RegX, N: 3},
+				bpf.JumpIfX{Cond: bpf.JumpGreaterThan, SkipTrue: 1},
+				bpf.RetConstant{Val: 0},
+				bpf.ALUOpConstant{Op: bpf.ALUOpOr, Val: lowlevel.SECCOMP_RET_ERRNO},
+				bpf.RetA{},
+			},
+			Decision{Type: Errno, Data: 12},
+			false,
+		},
+		{
+			[]bpf.Instruction{
+				bpf.LoadConstant{Dst: bpf.RegX, Val: 0},
+				bpf.ALUOpX{Op: bpf.ALUOpDiv},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+			},
+			Decision{Type: KillThread},
+			false,
+		},
+		{
+			[]bpf.Instruction{
+				bpf.LoadExtension{Num: bpf.ExtLen},
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: 64, SkipFalse: 1},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+				bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_THREAD},
+			},
+			Decision{Type: Allow},
+			false,
+		},
+		{[]bpf.Instruction{bpf.LoadExtension{Num: bpf.ExtCPUID}, bpf.RetA{}}, Decision{}, true},
+		{[]bpf.Instruction{bpf.LoadConstant{Dst: bpf.RegA, Val: 1}}, Decision{}, true},
+		{[]bpf.Instruction{bpf.LoadAbsolute{Off: 2, Size: 4}, bpf.RetA{}}, Decision{}, true},
+		{[]bpf.Instruction{bpf.LoadAbsolute{Off: 64, Size: 4}, bpf.RetA{}}, Decision{}, true},
+		{[]bpf.Instruction{bpf.LoadIndirect{Off: 0, Size: 4}, bpf.RetA{}}, Decision{}, true},
+	}
+	for i, tc := range cases {
+		program, err := bpf.Assemble(tc.program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Evaluate(program, lowlevel.SeccompData{}, "amd64")
+		if (err != nil) != tc.err || got != tc.expected {
+			t.Errorf(
+				"[%d/%d] Expected '%+v' (error: %t) got '%+v' (%v)",
+				i+1, len(cases),
+				tc.expected, tc.err,
+				got, err,
+			)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+// Handler decides the Response to give to a Notification.
+// The given context is cancelled when the Supervisor stops.
+type Handler func(ctx context.Context, n *Notification) Response
+
+// Supervisor receives the notifications of a Listener and dispatches them
+// to the Handler registered for their architecture and syscall number.
+//
+// When supervising threads of the current process, beware that notified
+// syscalls issued through [golang.org/x/sys/unix.RawSyscall] keep holding
+// their scheduler slot while waiting for the Supervisor.
+type Supervisor struct {
+	// Workers is the number of notifications handled concurrently,
+	// defaults to [runtime.NumCPU] if not strictly positive.
+	Workers int
+	// DefaultHandler handles syscalls without registered Handler,
+	// if nil such syscalls fail with ENOSYS.
+	DefaultHandler Handler
+
+	listener *Listener
+	mu       sync.RWMutex
+	handlers map[handlerKey]Handler
+}
+
+// handlerKey identifies a syscall by its audit architecture and number, as
+// the same number names different syscalls on different architectures.
+type handlerKey struct {
+	arch   uint32
+	number uint
+}
+
+// NewSupervisor creates a Supervisor for the given Listener.
+// The Listener stays owned by the caller.
+func NewSupervisor(listener *Listener) *Supervisor {
+	return &Supervisor{
+		listener: listener,
+		handlers: make(map[handlerKey]Handler),
+	}
+}
+
+// Handle registers the Handler for the given syscall number on the given GOARCH
+// string, replacing any previously registered one. A nil Handler unregisters it.
+// As in [SyscallCallFilter] Number, x32 syscall numbers include the
+// X32_SYSCALL_BIT and are registered on the "x32" pseudo architecture.
+func (s *Supervisor) Handle(arch string, number uint, h Handler) error {
+	key := handlerKey{arch: lowlevel.GetAuditArch(arch), number: number}
+	if arch == "x32" {
+		key.arch = lowlevel.GetAuditArch("amd64")
+	}
+	if key.arch == 0 {
+		return fmt.Errorf("unknown architecture '%s'", arch)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h == nil {
+		delete(s.handlers, key)
+		return nil
+	}
+	s.handlers[key] = h
+	return nil
+}
+
+func (s *Supervisor) handler(n *Notification) Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if h, ok := s.handlers[handlerKey{arch: n.Arch, number: n.Number}]; ok {
+		return h
+	}
+	if s.DefaultHandler != nil {
+		return s.DefaultHandler
+	}
+	return func(context.Context, *Notification) Response {
+		return ReturnErrno(unix.ENOSYS)
+	}
+}
+
+// Run receives and handles notifications until ctx gets cancelled, in which
+// case it returns ctx.Err(), or until no thread uses the filter anymore, in
+// which case it returns nil.
+//
+// Run waits for all running handlers to return before returning, the notifications
+// pending or received while stopping fail with ENOSYS.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if s.listener.Fd() < 0 {
+		return os.ErrClosed
+	}
+	// The pipe wakes the poll loop up when ctx gets cancelled
+	var wake [2]int
+	if err := unix.Pipe2(wake[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return err
+	}
+	defer unix.Close(wake[0])
+	defer unix.Close(wake[1])
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	woken := make(chan struct{})
+	go func() {
+		defer close(woken)
+		<-ctx.Done()
+		unix.Write(wake[1], []byte{0})
+	}()
+	// The pipe must outlive the write above
+	defer func() {
+		cancel()
+		<-woken
+	}()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	queue := make(chan *Notification)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				err := n.Respond(s.handler(n)(ctx, n))
+				var injectErr *InjectFDError
+				if err != nil && !errors.Is(err, unix.ENOENT) && !errors.Is(err, ErrAddFDUnsupported) && !errors.As(err, &injectErr) {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	err := s.receive(ctx, wake[0], queue)
+	if err != nil {
+		fail(err)
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return parent.Err()
+}
+
+// receive polls the listener and queues the received notifications, it
+// returns when ctx is done or when no thread uses the filter anymore.
+func (s *Supervisor) receive(ctx context.Context, wake int, queue chan<- *Notification) error {
+	for {
+		fds := []unix.PollFd{
+			{Fd: int32(s.listener.Fd()), Events: unix.POLLIN},
+			{Fd: int32(wake), Events: unix.POLLIN},
+		}
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return s.drain()
+		}
+		switch {
+		case fds[0].Revents&unix.POLLIN != 0:
+			n, err := s.listener.Receive()
+			if errors.Is(err, unix.ENOENT) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			select {
+			case queue <- n:
+			case <-ctx.Done():
+				// No worker will answer it, don't leave the thread blocked
+				err := n.Respond(ReturnErrno(unix.ENOSYS))
+				if err != nil && !errors.Is(err, unix.ENOENT) {
+					return err
+				}
+				return s.drain()
+			}
+		case fds[0].Revents&unix.POLLNVAL != 0:
+			return os.ErrClosed
+		case fds[0].Revents&(unix.POLLHUP|unix.POLLERR) != 0:
+			return nil
+		}
+	}
+}
+
+// drain answers the notifications pending on the listener with ENOSYS, as no
+// worker will handle them once the Supervisor stops.
+func (s *Supervisor) drain() error {
+	for {
+		fds := []unix.PollFd{{Fd: int32(s.listener.Fd()), Events: unix.POLLIN}}
+		_, err := unix.Poll(fds, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			return nil
+		}
+		n, err := s.listener.Receive()
+		if errors.Is(err, unix.ENOENT) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = n.Respond(ReturnErrno(unix.ENOSYS))
+		if err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/sys/unix"
+)
+
+func notifyFilter(numbers ...uint) Filter {
+	filter := Filter{
+		DefaultDecision: Decision{Type: Allow},
+		Architecture:    runtime.GOARCH,
+		Elements:        []FilterElement{{Decision: Decision{Type: UserNotify}}},
+	}
+	for _, number := range numbers {
+		filter.Elements[0].Match = append(filter.Elements[0].Match, SyscallCallFilter{
+			Number: number,
+			Args:   [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()},
+		})
+	}
+	return filter
+}
+
+// runNotified inserts filter on a throwaway thread and runs fn on it once
+// the listener got handed to the returned channel.
+func runNotified(t *testing.T, filter Filter, fn func()) (<-chan *Listener, <-chan bool) {
+	listenerc := make(chan *Listener, 1)
+	skipc := make(chan bool, 1)
+	go func() {
+		// This test uses seccomp to modify the calling thread, so run it on its own
+		// throwaway thread and do not unlock it when the goroutine exits.
+		runtime.LockOSThread()
+		defer close(skipc)
+
+		listener, err := filter.InsertWithListener()
+		if err != nil {
+			t.Logf("Seccomp: %v, skipping test", err)
+			skipc <- true
+			return
+		}
+		listenerc <- listener
+		fn()
+	}()
+	return listenerc, skipc
+}
+
+func TestSupervisorRun(t *testing.T) {
+	uid := unix.Getuid()
+	done := make(chan struct{})
+	listenerc, skipc := runNotified(
+		t,
+		notifyFilter(unix.SYS_GETPPID, unix.SYS_GETPGID, unix.SYS_GETUID),
+		func() {
+			defer close(done)
+			ret, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+			if errno != 0 || ret != 42 {
+				t.Errorf("expected getppid to return 42, got %d (%v)", ret, errno)
+			}
+			_, _, errno = unix.Syscall(unix.SYS_GETPGID, 0, 0, 0)
+			if errno != unix.EPERM {
+				t.Errorf("expected getpgid to fail with EPERM, got %v", errno)
+			}
+			ret, _, errno = unix.Syscall(unix.SYS_GETUID, 0, 0, 0)
+			if errno != 0 || int(ret) != uid {
+				t.Errorf("expected getuid to return %d, got %d (%v)", uid, ret, errno)
+			}
+		},
+	)
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	supervisor := NewSupervisor(listener)
+	supervisor.Workers = 2
+	supervisor.Handle(runtime.GOARCH, unix.SYS_GETPPID, func(ctx context.Context, n *Notification) Response {
+		if n.Number != unix.SYS_GETPPID {
+			t.Errorf("expected syscall %d, got %d", unix.SYS_GETPPID, n.Number)
+		}
+		return ReturnValue(42)
+	})
+	supervisor.Handle(runtime.GOARCH, unix.SYS_GETUID, func(ctx context.Context, n *Notification) Response {
+		return Continue()
+	})
+	supervisor.DefaultHandler = func(ctx context.Context, n *Notification) Response {
+		return ReturnErrno(unix.EPERM)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	err := supervisor.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSupervisorHandlerArch(t *testing.T) {
+	supervisor := NewSupervisor(NewListener(-1))
+	getppid := func(ctx context.Context, n *Notification) Response { return ReturnValue(42) }
+	// 110 is getppid on amd64 but iopl on 386
+	if err := supervisor.Handle("amd64", 110, getppid); err != nil {
+		t.Fatal(err)
+	}
+	if err := supervisor.Handle("x32", lowlevel.X32_SYSCALL_BIT+110, getppid); err != nil {
+		t.Fatal(err)
+	}
+	if err := supervisor.Handle("unknown", 110, getppid); err == nil {
+		t.Error("expected an error on unknown architecture")
+	}
+
+	cases := []struct {
+		arch     uint32
+		number   uint
+		expected Response
+	}{
+		{lowlevel.GetAuditArch("amd64"), 110, ReturnValue(42)},
+		{lowlevel.GetAuditArch("amd64"), lowlevel.X32_SYSCALL_BIT + 110, ReturnValue(42)},
+		{lowlevel.GetAuditArch("386"), 110, ReturnErrno(unix.ENOSYS)},
+		{lowlevel.GetAuditArch("amd64"), 111, ReturnErrno(unix.ENOSYS)},
+	}
+	for i, tc := range cases {
+		n := &Notification{Arch: tc.arch, Number: tc.number}
+		if got := supervisor.handler(n)(context.Background(), n); got != tc.expected {
+			t.Errorf("[%d/%d] Expected '%+v' got '%+v'", i+1, len(cases), tc.expected, got)
+		}
+	}
+}
+
+// stoppingContext is done but not yet cancelled, as a context seen by receive
+// when it gets cancelled after a notification was received.
+type stoppingContext struct {
+	context.Context
+	done chan struct{}
+}
+
+func (c stoppingContext) Done() <-chan struct{} { return c.done }
+
+func TestSupervisorReceiveStopping(t *testing.T) {
+	errnoc := make(chan unix.Errno, 1)
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_GETPPID), func() {
+		_, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+		errnoc <- errno
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	var wake [2]int
+	if err := unix.Pipe2(wake[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(wake[0])
+	defer unix.Close(wake[1])
+
+	ctx := stoppingContext{context.Background(), make(chan struct{})}
+	close(ctx.done)
+	// Nobody reads the queue, the notification has to be answered by receive
+	if err := NewSupervisor(listener).receive(ctx, wake[0], make(chan *Notification)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	select {
+	case errno := <-errnoc:
+		if errno != unix.ENOSYS {
+			t.Errorf("expected getppid to fail with ENOSYS, got %v", errno)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("getppid wasn't answered")
+	}
+}
+
+func TestSupervisorReceiveCancelledPending(t *testing.T) {
+	errnoc := make(chan unix.Errno, 1)
+	listenerc, skipc := runNotified(t, notifyFilter(unix.SYS_GETPPID), func() {
+		_, _, errno := unix.Syscall(unix.SYS_GETPPID, 0, 0, 0)
+		errnoc <- errno
+	})
+	var listener *Listener
+	select {
+	case listener = <-listenerc:
+	case <-skipc:
+		t.SkipNow()
+	}
+	defer listener.Close()
+
+	// Wait for the notification to be pending
+	fds := []unix.PollFd{{Fd: int32(listener.Fd()), Events: unix.POLLIN}}
+	if _, err := unix.Poll(fds, 5000); err != nil || fds[0].Revents&unix.POLLIN == 0 {
+		t.Fatalf("No pending notification: %v", err)
+	}
+	var wake [2]int
+	if err := unix.Pipe2(wake[:], unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(wake[0])
+	defer unix.Close(wake[1])
+	unix.Write(wake[1], []byte{0})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewSupervisor(listener).receive(ctx, wake[0], make(chan *Notification)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	select {
+	case errno := <-errnoc:
+		if errno != unix.ENOSYS {
+			t.Errorf("expected getppid to fail with ENOSYS, got %v", errno)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("getppid wasn't answered")
+	}
+}
+
+func TestSupervisorRunClosedListener(t *testing.T) {
+	listener := NewListener(-1)
+	err := NewSupervisor(listener).Run(context.Background())
+	if err == nil {
+		t.Error("expected an error on closed listener")
+	}
+}
@@ -9,15 +9,6 @@ import (
 	"golang.org/x/net/bpf"
 )
 
-// Represent a simple equality check for a syscall argument
-type SyscallArgument struct {
-	Value uintptr
-	isAny bool
-}
-
-// Special SyscallArgument that always match (used to ignore the value of that argument)
-func Any() SyscallArgument { return SyscallArgument{Value: 0, isAny: true} }
-
 // Smallest element of a seccomp filter, this allow to check for a specific syscall and its arguments
 type SyscallCallFilter struct {
 	// Number is the syscall number to match
@@ -27,113 +18,104 @@ type SyscallCallFilter struct {
 	Args [6]SyscallArgument
 }
 
+// NewSyscallCallFilter builds a SyscallCallFilter for the named syscall (e.g. "openat")
+// numbered for the given architecture, missing args are set to Any().
+func NewSyscallCallFilter(arch string, name string, args ...SyscallArgument) (SyscallCallFilter, error) {
+	if len(args) > 6 {
+		return SyscallCallFilter{}, fmt.Errorf("syscall '%s' can't have %d arguments", name, len(args))
+	}
+	number, ok := lowlevel.SyscallNumber(arch, name)
+	if !ok {
+		return SyscallCallFilter{}, fmt.Errorf("unknown syscall '%s' for architecture '%s'", name, arch)
+	}
+	filter := SyscallCallFilter{Number: number}
+	for i := range filter.Args {
+		if i < len(args) {
+			filter.Args[i] = args[i]
+		} else {
+			filter.Args[i] = Any()
+		}
+	}
+	return filter, nil
+}
+
+// Name returns the name of the filtered syscall on the given architecture,
+// the second returned value is false if the syscall number is unknown.
+func (a SyscallCallFilter) Name(arch string) (string, bool) {
+	return lowlevel.SyscallName(arch, a.Number)
+}
+
 // Match tells if the two SyscallCallFilter are matching for the same call
 func (a SyscallCallFilter) Match(b SyscallCallFilter) bool {
 	if a.Number != b.Number {
 		return false
 	}
 	for i, v := range a.Args {
-		if v.isAny || b.Args[i].isAny {
-			continue
-		}
-		if v.Value != b.Args[i].Value {
+		if !v.set().overlaps(b.Args[i].set()) {
 			return false
 		}
 	}
 	return true
 }
 
-// IsMorePrecise tell if the given SyscallCallFilter is more precise than the one given in argument.
+// IsMorePrecise tell if the given SyscallCallFilter is more precise than the one given in argument,
+// that is if every call it matches is also matched by the one given in argument.
 // This shall only be used when Match returns true, else result doesn't bear any sense.
 func (a SyscallCallFilter) IsMorePrecise(b SyscallCallFilter) bool {
 	for i, v := range a.Args {
-		if v.isAny && !b.Args[i].isAny {
+		if !v.set().isSubsetOf(b.Args[i].set()) {
 			return false
 		}
 	}
 	return true
 }
 
+// compileArgs generates the checks of all the arguments, they fall through if all
+// arguments match and skip distanceToNoMatch instructions past their end otherwise.
+func (a SyscallCallFilter) compileArgs(distanceToNoMatch uint, arch string) []bpf.Instruction {
+	var instructions []bpf.Instruction
+	/* We are constructing the instruction list from the end
+	*  to the begining, so start with the last argument
+	 */
+	distanceToArgNoMatch := distanceToNoMatch
+	for i := len(a.Args) - 1; i >= 0; i-- {
+		argInstructions := a.Args[i].compile(i, distanceToArgNoMatch, arch)
+		distanceToArgNoMatch += uint(len(argInstructions))
+		instructions = append(argInstructions, instructions...)
+	}
+	return instructions
+}
+
 func (a SyscallCallFilter) compile(distanceToMatch uint, distanceToNoMatch uint, arch string) []bpf.Instruction {
 	if distanceToMatch == distanceToNoMatch {
 		return nil
 	}
-	var instructions []bpf.Instruction
-	/* We are constructing the instruction list from the end
-	*  to the begining, so start with the arguments
-	 */
-	for i, arg := range a.Args {
-		if !arg.isAny {
-			argName := fmt.Sprintf("Arg%d", i)
-			argInstructions := []bpf.Instruction{
-				lowlevel.LoadSeccompDataField(argName, false, arch),
-			}
-			if len(instructions) == 0 {
-				distanceToNoMatch += 2
-			}
-			if lowlevel.ArchIs64Bits(arch) {
-				argInstructions = append(
-					argInstructions,
-					bpf.JumpIf{
-						Cond:     bpf.JumpNotEqual,
-						SkipTrue: uint8(distanceToNoMatch) + 2,
-						Val:      uint32(arg.Value),
-					},
-					lowlevel.LoadSeccompDataField(argName, true, arch),
-					bpf.JumpIf{
-						Cond:     bpf.JumpNotEqual,
-						SkipTrue: uint8(distanceToNoMatch),
-						Val:      uint32(arg.Value >> 32),
-					},
-				)
-			} else {
-				argInstructions = append(
-					argInstructions,
-					bpf.JumpIf{
-						Cond:     bpf.JumpNotEqual,
-						SkipTrue: uint8(distanceToNoMatch),
-						Val:      uint32(arg.Value),
-					},
-				)
-			}
-			if len(instructions) == 0 {
-				distanceToNoMatch -= 2
-				argInstructions = append(
-					argInstructions,
-					lowlevel.LoadSeccompDataField("Number", false, arch),
-					bpf.Jump{Skip: uint32(distanceToMatch)},
-				)
-			}
-			distanceToMatch += uint(len(argInstructions))
-			distanceToNoMatch += uint(len(argInstructions))
-			instructions = append(
-				argInstructions,
-				instructions...,
-			)
-		}
+	// Arguments checks overwrite the syscall number loaded in the accumulator,
+	// so it has to be reloaded before going on with the next checks.
+	noMatch := []bpf.Instruction{
+		lowlevel.LoadSeccompDataField("Number", false, arch),
+	}
+	if distanceToNoMatch != 0 {
+		noMatch = append(noMatch, bpf.Jump{Skip: uint32(distanceToNoMatch)})
 	}
+	instructions := a.compileArgs(1, arch)
 
 	// Now let's prepend with syscall number check
 	if len(instructions) == 0 {
 		// All args checks were "Any"
-		instructions = append(instructions, bpf.JumpIf{
-			Cond:      bpf.JumpEqual,
-			SkipTrue:  uint8(distanceToMatch),
-			SkipFalse: uint8(distanceToNoMatch),
-			Val:       uint32(a.Number),
-		})
-	} else {
-		instructions = append(
-			[]bpf.Instruction{
-				bpf.JumpIf{
-					Cond:     bpf.JumpNotEqual,
-					SkipTrue: uint8(distanceToNoMatch),
-					Val:      uint32(a.Number),
-				},
-			},
-			instructions...,
-		)
+		return []bpf.Instruction{
+			jumpIf(bpf.JumpEqual, distanceToMatch, distanceToNoMatch, uint32(a.Number)),
+		}
 	}
-
-	return instructions
+	instructions = append(
+		instructions,
+		bpf.Jump{Skip: uint32(uint(len(noMatch)) + distanceToMatch)},
+	)
+	instructions = append(instructions, noMatch...)
+	return append(
+		[]bpf.Instruction{
+			jumpIf(bpf.JumpNotEqual, uint(len(instructions))+distanceToNoMatch, 0, uint32(a.Number)),
+		},
+		instructions...,
+	)
 }
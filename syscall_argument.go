@@ -0,0 +1,376 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// Operator is the comparison made between a syscall argument and a SyscallArgument Value
+type Operator uint8
+
+const (
+	// OpEqual matches arguments equal to Value
+	OpEqual Operator = iota
+	// OpNotEqual matches arguments different from Value
+	OpNotEqual
+	// OpLessThan matches arguments strictly lower than Value
+	OpLessThan
+	// OpLessOrEqual matches arguments lower or equal to Value
+	OpLessOrEqual
+	// OpGreaterThan matches arguments strictly greater than Value
+	OpGreaterThan
+	// OpGreaterOrEqual matches arguments greater or equal to Value
+	OpGreaterOrEqual
+	// OpMaskedEqual matches arguments which bits selected by Mask are equal to Value
+	OpMaskedEqual
+)
+
+func (o Operator) String() string {
+	switch o {
+	case OpEqual:
+		return "=="
+	case OpNotEqual:
+		return "!="
+	case OpLessThan:
+		return "<"
+	case OpLessOrEqual:
+		return "<="
+	case OpGreaterThan:
+		return ">"
+	case OpGreaterOrEqual:
+		return ">="
+	case OpMaskedEqual:
+		return "&"
+	default:
+		return fmt.Sprintf("Operator(%d)", uint8(o))
+	}
+}
+
+// Represent a comparison check for a syscall argument, by default an equality check.
+// Comparisons are unsigned, on 32 bits architectures only the lower 32 bits of Value are used.
+type SyscallArgument struct {
+	Value uintptr
+	isAny bool
+	// Op is the comparison operator between the argument and Value
+	Op Operator
+	// Mask is the mask applied to the argument before comparing it with Value,
+	// only used by OpMaskedEqual
+	Mask uintptr
+}
+
+// Special SyscallArgument that always match (used to ignore the value of that argument)
+func Any() SyscallArgument { return SyscallArgument{Value: 0, isAny: true} }
+
+// Equal matches arguments equal to value
+func Equal(value uintptr) SyscallArgument { return SyscallArgument{Value: value, Op: OpEqual} }
+
+// NotEqual matches arguments different from value
+func NotEqual(value uintptr) SyscallArgument { return SyscallArgument{Value: value, Op: OpNotEqual} }
+
+// LessThan matches arguments strictly lower than value
+func LessThan(value uintptr) SyscallArgument { return SyscallArgument{Value: value, Op: OpLessThan} }
+
+// LessOrEqual matches arguments lower or equal to value
+func LessOrEqual(value uintptr) SyscallArgument {
+	return SyscallArgument{Value: value, Op: OpLessOrEqual}
+}
+
+// GreaterThan matches arguments strictly greater than value
+func GreaterThan(value uintptr) SyscallArgument {
+	return SyscallArgument{Value: value, Op: OpGreaterThan}
+}
+
+// GreaterOrEqual matches arguments greater or equal to value
+func GreaterOrEqual(value uintptr) SyscallArgument {
+	return SyscallArgument{Value: value, Op: OpGreaterOrEqual}
+}
+
+// MaskedEqual matches arguments which bits selected by mask are equal to value,
+// that is (argument & mask) == value
+func MaskedEqual(mask uintptr, value uintptr) SyscallArgument {
+	return SyscallArgument{Value: value, Op: OpMaskedEqual, Mask: mask}
+}
+
+// valueRange is an inclusive range of argument values
+type valueRange struct {
+	low, high uint64
+}
+
+// argumentSet is the set of argument values matched by a SyscallArgument,
+// either a sorted list of disjoint and non adjacent ranges, or, if masked
+// is set, all the values x such that x & mask == value.
+type argumentSet struct {
+	ranges      []valueRange
+	masked      bool
+	mask, value uint64
+}
+
+func (a SyscallArgument) set() argumentSet {
+	v := uint64(a.Value)
+	if a.isAny {
+		return argumentSet{ranges: []valueRange{{0, math.MaxUint64}}}
+	}
+	switch a.Op {
+	case OpNotEqual:
+		var set argumentSet
+		if v != 0 {
+			set.ranges = append(set.ranges, valueRange{0, v - 1})
+		}
+		if v != math.MaxUint64 {
+			set.ranges = append(set.ranges, valueRange{v + 1, math.MaxUint64})
+		}
+		return set
+	case OpLessThan:
+		if v == 0 {
+			return argumentSet{}
+		}
+		return argumentSet{ranges: []valueRange{{0, v - 1}}}
+	case OpLessOrEqual:
+		return argumentSet{ranges: []valueRange{{0, v}}}
+	case OpGreaterThan:
+		if v == math.MaxUint64 {
+			return argumentSet{}
+		}
+		return argumentSet{ranges: []valueRange{{v + 1, math.MaxUint64}}}
+	case OpGreaterOrEqual:
+		return argumentSet{ranges: []valueRange{{v, math.MaxUint64}}}
+	case OpMaskedEqual:
+		return argumentSet{masked: true, mask: uint64(a.Mask), value: v}
+	default:
+		return argumentSet{ranges: []valueRange{{v, v}}}
+	}
+}
+
+func (s argumentSet) isEmpty() bool {
+	if s.masked {
+		return s.value&^s.mask != 0
+	}
+	return len(s.ranges) == 0
+}
+
+func (s argumentSet) contains(v uint64) bool {
+	if s.masked {
+		return v&s.mask == s.value
+	}
+	for _, r := range s.ranges {
+		if r.low <= v && v <= r.high {
+			return true
+		}
+	}
+	return false
+}
+
+// nextMasked returns the smallest x greater or equal to low such that
+// x & mask == value, if any.
+func nextMasked(low, mask, value uint64) (uint64, bool) {
+	if value&^mask != 0 {
+		return 0, false
+	}
+	differ := (low ^ value) & mask
+	if differ == 0 {
+		return low, true
+	}
+	// At the highest fixed bit differing from low, either x has a 1 and the
+	// lower free bits are cleared, or x has a 0 and the lowest unset free bit
+	// above it must be set.
+	differing := 63 - bits.LeadingZeros64(differ)
+	if low&(1<<differing) == 0 {
+		below := uint64(1)<<(differing+1) - 1
+		return low&^below | value&below, true
+	}
+	free := ^mask &^ low &^ (uint64(1)<<(differing+1) - 1)
+	if free == 0 {
+		return 0, false
+	}
+	bit := free & -free
+	return low&^(bit-1) | bit | value&(bit-1), true
+}
+
+// complement returns the complement of a ranges set
+func (s argumentSet) complement() argumentSet {
+	var complement argumentSet
+	var next uint64 = 0
+	for _, r := range s.ranges {
+		if r.low > next {
+			complement.ranges = append(complement.ranges, valueRange{next, r.low - 1})
+		}
+		if r.high == math.MaxUint64 {
+			return complement
+		}
+		next = r.high + 1
+	}
+	complement.ranges = append(complement.ranges, valueRange{next, math.MaxUint64})
+	return complement
+}
+
+func (s argumentSet) overlaps(o argumentSet) bool {
+	if s.isEmpty() || o.isEmpty() {
+		return false
+	}
+	switch {
+	case s.masked && o.masked:
+		return (s.value^o.value)&s.mask&o.mask == 0
+	case s.masked:
+		return o.overlaps(s)
+	case o.masked:
+		for _, r := range s.ranges {
+			if x, ok := nextMasked(r.low, o.mask, o.value); ok && x <= r.high {
+				return true
+			}
+		}
+		return false
+	}
+	for _, a := range s.ranges {
+		for _, b := range o.ranges {
+			if a.low <= b.high && b.low <= a.high {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s argumentSet) isSubsetOf(o argumentSet) bool {
+	if s.isEmpty() {
+		return true
+	}
+	if !o.masked {
+		return !s.overlaps(o.complement())
+	}
+	if s.masked {
+		return o.mask&^s.mask == 0 && s.value&o.mask == o.value
+	}
+	// All the values of a range share the bits above the highest bit
+	// differing between its bounds, the others take all possible values.
+	for _, r := range s.ranges {
+		if r.low&o.mask != o.value {
+			return false
+		}
+		if r.low != r.high {
+			differing := 63 - bits.LeadingZeros64(r.low^r.high)
+			if o.mask&(uint64(1)<<(differing+1)-1) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Matches tells if the given argument value is matched
+func (a SyscallArgument) Matches(value uintptr) bool {
+	return a.set().contains(uint64(value))
+}
+
+// matchesOn tells if the given argument value is matched by the argument check
+// compiled for the given architecture, which only uses the lower 32 bits on 32 bits
+// architectures.
+func (a SyscallArgument) matchesOn(value uint64, arch string) bool {
+	if !lowlevel.ArchIs64Bits(arch) {
+		a.Value = uintptr(uint32(a.Value))
+		a.Mask = uintptr(uint32(a.Mask))
+		value = uint64(uint32(value))
+	}
+	return a.set().contains(value)
+}
+
+// fitsArch tells if the argument check can be compiled for the given architecture,
+// the values and masks compared on 32 bits architectures must fit in 32 bits.
+func (a SyscallArgument) fitsArch(arch string) bool {
+	if a.isAny || lowlevel.ArchIs64Bits(arch) {
+		return true
+	}
+	return uint64(a.Value)>>32 == 0 && (a.Op != OpMaskedEqual || uint64(a.Mask)>>32 == 0)
+}
+
+// failCondition is the jump condition to use to leave the argument check
+// when comparing a 32 bits word
+func (o Operator) failCondition() bpf.JumpTest {
+	switch o {
+	case OpNotEqual:
+		return bpf.JumpEqual
+	case OpLessThan:
+		return bpf.JumpGreaterOrEqual
+	case OpLessOrEqual:
+		return bpf.JumpGreaterThan
+	case OpGreaterThan:
+		return bpf.JumpLessOrEqual
+	case OpGreaterOrEqual:
+		return bpf.JumpLessThan
+	default:
+		return bpf.JumpNotEqual
+	}
+}
+
+// compile generates the instructions checking the argument at the given index,
+// they fall through if the argument matches and skip distanceToNoMatch
+// instructions past their end otherwise.
+func (a SyscallArgument) compile(index int, distanceToNoMatch uint, arch string) []bpf.Instruction {
+	if a.isAny {
+		return nil
+	}
+	argName := fmt.Sprintf("Arg%d", index)
+	low := uint32(a.Value)
+	if a.Op == OpMaskedEqual {
+		return a.compileMasked(argName, distanceToNoMatch, arch)
+	}
+	if !lowlevel.ArchIs64Bits(arch) {
+		return []bpf.Instruction{
+			lowlevel.LoadSeccompDataField(argName, false, arch),
+			jumpIf(a.Op.failCondition(), distanceToNoMatch, 0, low),
+		}
+	}
+	high := uint32(uint64(a.Value) >> 32)
+	switch a.Op {
+	case OpEqual:
+		return []bpf.Instruction{
+			lowlevel.LoadSeccompDataField(argName, false, arch),
+			jumpIf(bpf.JumpNotEqual, distanceToNoMatch+2, 0, low),
+			lowlevel.LoadSeccompDataField(argName, true, arch),
+			jumpIf(bpf.JumpNotEqual, distanceToNoMatch, 0, high),
+		}
+	case OpNotEqual:
+		return []bpf.Instruction{
+			lowlevel.LoadSeccompDataField(argName, false, arch),
+			bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 2, Val: low},
+			lowlevel.LoadSeccompDataField(argName, true, arch),
+			jumpIf(bpf.JumpEqual, distanceToNoMatch, 0, high),
+		}
+	default:
+		// The high word decides unless it is equal, in which case the low word does
+		strict := bpf.JumpGreaterThan
+		if a.Op == OpLessThan || a.Op == OpLessOrEqual {
+			strict = bpf.JumpLessThan
+		}
+		return []bpf.Instruction{
+			lowlevel.LoadSeccompDataField(argName, true, arch),
+			bpf.JumpIf{Cond: strict, SkipTrue: 3, Val: high},
+			jumpIf(bpf.JumpNotEqual, distanceToNoMatch+2, 0, high),
+			lowlevel.LoadSeccompDataField(argName, false, arch),
+			jumpIf(a.Op.failCondition(), distanceToNoMatch, 0, low),
+		}
+	}
+}
+
+func (a SyscallArgument) compileMasked(argName string, distanceToNoMatch uint, arch string) []bpf.Instruction {
+	instructions := []bpf.Instruction{
+		lowlevel.LoadSeccompDataField(argName, false, arch),
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: uint32(a.Mask)},
+		jumpIf(bpf.JumpNotEqual, distanceToNoMatch, 0, uint32(a.Value)),
+	}
+	if !lowlevel.ArchIs64Bits(arch) {
+		return instructions
+	}
+	instructions[2] = jumpIf(bpf.JumpNotEqual, distanceToNoMatch+3, 0, uint32(a.Value))
+	return append(
+		instructions,
+		lowlevel.LoadSeccompDataField(argName, true, arch),
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: uint32(uint64(a.Mask) >> 32)},
+		jumpIf(bpf.JumpNotEqual, distanceToNoMatch, 0, uint32(uint64(a.Value)>>32)),
+	)
+}
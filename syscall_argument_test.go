@@ -0,0 +1,267 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+// value64 returns the 64 bits value as a uintptr, skipping the test on hosts
+// where uintptr only holds 32 bits.
+func value64(t *testing.T, value uint64) uintptr {
+	t.Helper()
+	if uint64(uintptr(value)) != value {
+		t.Skipf("uintptr can't hold 0x%x", value)
+	}
+	return uintptr(value)
+}
+
+type TestCasesSyscallArgumentMatches struct {
+	arg      SyscallArgument
+	value    uintptr
+	expected bool
+}
+
+func TestSyscallArgumentMatches(t *testing.T) {
+	cases := []TestCasesSyscallArgumentMatches{
+		{Any(), 42, true},
+		{Equal(42), 42, true},
+		{Equal(42), 43, false},
+		{NotEqual(42), 42, false},
+		{NotEqual(42), 0, true},
+		{LessThan(42), 41, true},
+		{LessThan(42), 42, false},
+		{LessThan(0), 0, false},
+		{LessOrEqual(42), 42, true},
+		{LessOrEqual(42), 43, false},
+		{GreaterThan(42), 43, true},
+		{GreaterThan(42), 42, false},
+		{GreaterThan(^uintptr(0)), ^uintptr(0), false},
+		{GreaterOrEqual(42), 42, true},
+		{GreaterOrEqual(42), 41, false},
+		{MaskedEqual(0x4, 0x4), 0x7, true},
+		{MaskedEqual(0x4, 0x4), 0x3, false},
+		{MaskedEqual(0x4, 0), 0x3, true},
+		{MaskedEqual(0x4, 0x8), 0x8, false},
+	}
+	for i, tc := range cases {
+		got := tc.arg.Matches(tc.value)
+		if got != tc.expected {
+			t.Errorf(
+				"[%d/%d] %v %d: Expected '%t' got '%t'",
+				i+1, len(cases),
+				tc.arg.Op, tc.value,
+				tc.expected, got,
+			)
+		}
+	}
+}
+
+type TestCasesSyscallArgumentSets struct {
+	arg1     SyscallArgument
+	arg2     SyscallArgument
+	overlaps bool
+	subset   bool
+}
+
+func TestSyscallArgumentSets(t *testing.T) {
+	cases := []TestCasesSyscallArgumentSets{
+		{Equal(1), Any(), true, true},
+		{Any(), Equal(1), true, false},
+		{Equal(1), Equal(2), false, false},
+		{Equal(1), LessThan(2), true, true},
+		{LessThan(2), Equal(1), true, false},
+		{LessThan(5), GreaterThan(2), true, false},
+		{LessThan(5), GreaterThan(5), false, false},
+		{LessThan(5), LessOrEqual(5), true, true},
+		{NotEqual(5), LessThan(5), true, false},
+		{GreaterThan(5), NotEqual(5), true, true},
+		{NotEqual(5), Equal(5), false, false},
+		{GreaterOrEqual(0), Any(), true, true},
+		{Any(), GreaterOrEqual(0), true, true},
+		{LessThan(0), Equal(1), false, true},
+		{MaskedEqual(0x4, 0x4), MaskedEqual(0x4, 0), false, false},
+		{MaskedEqual(0x6, 0x4), MaskedEqual(0x4, 0x4), true, true},
+		{MaskedEqual(0x4, 0x4), MaskedEqual(0x6, 0x4), true, false},
+		{MaskedEqual(0x4, 0x4), MaskedEqual(0x2, 0x2), true, false},
+		{Equal(0x5), MaskedEqual(0x4, 0x4), true, true},
+		{Equal(0x3), MaskedEqual(0x4, 0x4), false, false},
+		{LessThan(4), MaskedEqual(0x4, 0x4), false, false},
+		{LessThan(4), MaskedEqual(^uintptr(0x3), 0), true, true},
+		{LessOrEqual(4), MaskedEqual(^uintptr(0x3), 0), true, false},
+		{MaskedEqual(^uintptr(0x3), 0), LessThan(4), true, true},
+		{MaskedEqual(0x4, 0x4), GreaterThan(3), true, true},
+		{MaskedEqual(0x4, 0x4), NotEqual(4), true, false},
+		{MaskedEqual(0x4, 0x4), NotEqual(3), true, true},
+		{MaskedEqual(0x4, 0x8), Any(), false, true},
+	}
+	for i, tc := range cases {
+		set1, set2 := tc.arg1.set(), tc.arg2.set()
+		if got := set1.overlaps(set2); got != tc.overlaps {
+			t.Errorf("[%d/%d] overlaps: Expected '%t' got '%t'", i+1, len(cases), tc.overlaps, got)
+		}
+		if got := set1.isSubsetOf(set2); got != tc.subset {
+			t.Errorf("[%d/%d] subset: Expected '%t' got '%t'", i+1, len(cases), tc.subset, got)
+		}
+	}
+}
+
+func TestSyscallArgumentSetsExhaustive(t *testing.T) {
+	// Build arguments only matching values lower than 64 so that the sets
+	// can be compared with a brute force evaluation.
+	var args []SyscallArgument
+	for v := uintptr(0); v < 64; v += 7 {
+		args = append(args, Equal(v), LessThan(v), LessOrEqual(v))
+	}
+	for _, mask := range []uintptr{0x1, 0x5, 0x12, 0x3c, 0x3f} {
+		for _, v := range []uintptr{0, 0x1, 0x4, 0x14, 0x2c} {
+			args = append(args, MaskedEqual(^uintptr(0x3f)|mask, v))
+		}
+	}
+	for _, a := range args {
+		for _, b := range args {
+			overlaps, subset := false, true
+			for v := uintptr(0); v < 64; v++ {
+				if a.Matches(v) && b.Matches(v) {
+					overlaps = true
+				}
+				if a.Matches(v) && !b.Matches(v) {
+					subset = false
+				}
+			}
+			if got := a.set().overlaps(b.set()); got != overlaps {
+				t.Errorf("%+v overlaps %+v: Expected '%t' got '%t'", a, b, overlaps, got)
+			}
+			if got := a.set().isSubsetOf(b.set()); got != subset {
+				t.Errorf("%+v subset of %+v: Expected '%t' got '%t'", a, b, subset, got)
+			}
+		}
+	}
+}
+
+func TestNextMasked(t *testing.T) {
+	for low := uint64(0); low < 16; low++ {
+		for mask := uint64(0); mask < 16; mask++ {
+			for value := uint64(0); value < 16; value++ {
+				expected, found := uint64(0), false
+				if value&^mask == 0 {
+					for expected = low; expected&mask != value; expected++ {
+					}
+					found = true
+				}
+				got, ok := nextMasked(low, mask, value)
+				if ok != found || got != expected {
+					t.Errorf("nextMasked(%d, %d, %d): Expected '%d, %t' got '%d, %t'", low, mask, value, expected, found, got, ok)
+				}
+			}
+		}
+	}
+}
+
+type TestCasesSyscallArgumentCompile struct {
+	arg      SyscallArgument
+	arch     string
+	expected []bpf.Instruction
+}
+
+func TestSyscallArgumentCompile(t *testing.T) {
+	cases := []TestCasesSyscallArgumentCompile{
+		{Any(), "386", nil},
+		{
+			LessThan(0x10),
+			"386",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, SkipTrue: 3, Val: 0x10},
+			},
+		},
+		{
+			NotEqual(value64(t, 0x200000001)),
+			"amd64",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 2, Val: 1},
+				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 3, Val: 2},
+			},
+		},
+		{
+			GreaterOrEqual(value64(t, 0x200000001)),
+			"amd64",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpGreaterThan, SkipTrue: 3, Val: 2},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 5, Val: 2},
+				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpLessThan, SkipTrue: 3, Val: 1},
+			},
+		},
+		{
+			LessOrEqual(value64(t, 0x200000001)),
+			"amd64",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpLessThan, SkipTrue: 3, Val: 2},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 5, Val: 2},
+				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpGreaterThan, SkipTrue: 3, Val: 1},
+			},
+		},
+		{
+			MaskedEqual(0x4, 0x4),
+			"386",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", false, "386"),
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x4},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 3, Val: 0x4},
+			},
+		},
+		{
+			MaskedEqual(value64(t, 0x100000004), 0x4),
+			"amd64",
+			[]bpf.Instruction{
+				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x4},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 6, Val: 0x4},
+				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
+				bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x1},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 3, Val: 0},
+			},
+		},
+	}
+	for i, tc := range cases {
+		got := tc.arg.compile(1, 3, tc.arch)
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"[%d/%d] Expected '%+v' got '%+v'",
+				i+1, len(cases),
+				tc.expected,
+				got,
+			)
+		}
+	}
+}
+
+func TestSyscallArgumentMatchesOn(t *testing.T) {
+	cases := []struct {
+		arg      SyscallArgument
+		value    uint64
+		arch     string
+		expected bool
+	}{
+		{Equal(1), 0x100000001, "amd64", false},
+		{Equal(1), 0x100000001, "386", true},
+		{GreaterThan(value64(t, 0x100000000)), 1, "386", true},
+		{MaskedEqual(value64(t, 0x100000001), value64(t, 0x100000001)), 1, "386", true},
+		{MaskedEqual(value64(t, 0x100000001), value64(t, 0x100000001)), 1, "arm64", false},
+	}
+	for i, tc := range cases {
+		if got := tc.arg.matchesOn(tc.value, tc.arch); got != tc.expected {
+			t.Errorf("[%d/%d] Expected '%t' got '%t'", i+1, len(cases), tc.expected, got)
+		}
+	}
+}
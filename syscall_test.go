@@ -22,12 +22,12 @@ func TestSyscallMatch(t *testing.T) {
 			SyscallCallFilter{
 				Number: 0,
 				Args: [6]SyscallArgument{
-					{0, false},
-					{1, false},
-					{2, false},
-					{3, false},
-					{4, false},
-					{5, false},
+					{Value: 0},
+					{Value: 1},
+					{Value: 2},
+					{Value: 3},
+					{Value: 4},
+					{Value: 5},
 				},
 			},
 			SyscallCallFilter{},
@@ -43,12 +43,12 @@ func TestSyscallMatch(t *testing.T) {
 			SyscallCallFilter{
 				Number: 0,
 				Args: [6]SyscallArgument{
-					{0, false},
-					{1, true},
-					{2, true},
-					{3, true},
-					{4, true},
-					{5, true},
+					{Value: 0},
+					{Value: 1, isAny: true},
+					{Value: 2, isAny: true},
+					{Value: 3, isAny: true},
+					{Value: 4, isAny: true},
+					{Value: 5, isAny: true},
 				},
 			},
 			true,
@@ -57,12 +57,12 @@ func TestSyscallMatch(t *testing.T) {
 			SyscallCallFilter{
 				Number: 0,
 				Args: [6]SyscallArgument{
-					{0, false},
-					{1, true},
-					{2, true},
-					{3, true},
-					{4, true},
-					{5, true},
+					{Value: 0},
+					{Value: 1, isAny: true},
+					{Value: 2, isAny: true},
+					{Value: 3, isAny: true},
+					{Value: 4, isAny: true},
+					{Value: 5, isAny: true},
 				},
 			},
 			SyscallCallFilter{},
@@ -73,6 +73,21 @@ func TestSyscallMatch(t *testing.T) {
 			SyscallCallFilter{},
 			false,
 		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{LessThan(5), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{GreaterThan(2), Any(), Any(), Any(), Any(), Any()}},
+			true,
+		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{LessThan(5), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{GreaterOrEqual(5), Any(), Any(), Any(), Any(), Any()}},
+			false,
+		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{NotEqual(5), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{Equal(5), Any(), Any(), Any(), Any(), Any()}},
+			false,
+		},
 	}
 	for _, tc := range cases {
 		got := tc.arg1.Match(tc.arg2)
@@ -92,12 +107,12 @@ func TestSyscallIsMorePrecise(t *testing.T) {
 		{
 			SyscallCallFilter{
 				Args: [6]SyscallArgument{
-					{0, false},
-					{1, true},
-					{2, true},
-					{3, true},
-					{4, true},
-					{5, true},
+					{Value: 0},
+					{Value: 1, isAny: true},
+					{Value: 2, isAny: true},
+					{Value: 3, isAny: true},
+					{Value: 4, isAny: true},
+					{Value: 5, isAny: true},
 				},
 			},
 			SyscallCallFilter{},
@@ -107,16 +122,31 @@ func TestSyscallIsMorePrecise(t *testing.T) {
 			SyscallCallFilter{},
 			SyscallCallFilter{
 				Args: [6]SyscallArgument{
-					{0, false},
-					{1, true},
-					{2, true},
-					{3, true},
-					{4, true},
-					{5, true},
+					{Value: 0},
+					{Value: 1, isAny: true},
+					{Value: 2, isAny: true},
+					{Value: 3, isAny: true},
+					{Value: 4, isAny: true},
+					{Value: 5, isAny: true},
 				},
 			},
 			true,
 		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{Equal(3), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{LessThan(5), Any(), Any(), Any(), Any(), Any()}},
+			true,
+		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{LessThan(5), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{GreaterThan(2), Any(), Any(), Any(), Any(), Any()}},
+			false,
+		},
+		{
+			SyscallCallFilter{Args: [6]SyscallArgument{GreaterThan(5), Any(), Any(), Any(), Any(), Any()}},
+			SyscallCallFilter{Args: [6]SyscallArgument{NotEqual(5), Any(), Any(), Any(), Any(), Any()}},
+			true,
+		},
 	}
 	for _, tc := range cases {
 		got := tc.arg1.IsMorePrecise(tc.arg2)
@@ -146,12 +176,12 @@ func TestSyscallCompile(t *testing.T) {
 		{
 			SyscallCallFilter{
 				Args: [6]SyscallArgument{
-					{1, false},
-					{2, false},
-					{3, false},
-					{4, false},
-					{5, false},
-					{6, false},
+					{Value: 1},
+					{Value: 2},
+					{Value: 3},
+					{Value: 4},
+					{Value: 5},
+					{Value: 6},
 				},
 			},
 			1,
@@ -159,31 +189,31 @@ func TestSyscallCompile(t *testing.T) {
 			"386",
 			[]bpf.Instruction{
 				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 14, Val: 0},
-				lowlevel.LoadSeccompDataField("Arg5", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 12, Val: 6},
-				lowlevel.LoadSeccompDataField("Arg4", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 10, Val: 5},
-				lowlevel.LoadSeccompDataField("Arg3", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 8, Val: 4},
-				lowlevel.LoadSeccompDataField("Arg2", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 6, Val: 3},
-				lowlevel.LoadSeccompDataField("Arg1", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 4, Val: 2},
 				lowlevel.LoadSeccompDataField("Arg0", false, "386"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 2, Val: 1},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 11, Val: 1},
+				lowlevel.LoadSeccompDataField("Arg1", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 9, Val: 2},
+				lowlevel.LoadSeccompDataField("Arg2", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 7, Val: 3},
+				lowlevel.LoadSeccompDataField("Arg3", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 5, Val: 4},
+				lowlevel.LoadSeccompDataField("Arg4", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 3, Val: 5},
+				lowlevel.LoadSeccompDataField("Arg5", false, "386"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 1, Val: 6},
+				bpf.Jump{Skip: 2},
 				lowlevel.LoadSeccompDataField("Number", false, "386"),
-				bpf.Jump{Skip: 1},
 			},
 		},
 		{
 			SyscallCallFilter{
 				Args: [6]SyscallArgument{
-					{0x200000001, false},
-					{0x400000003, false},
-					{0x600000005, false},
-					{0x800000007, false},
-					{0xa00000009, false},
-					{0xc0000000b, false},
+					{Value: value64(t, 0x200000001)},
+					{Value: value64(t, 0x400000003)},
+					{Value: value64(t, 0x600000005)},
+					{Value: value64(t, 0x800000007)},
+					{Value: value64(t, 0xa00000009)},
+					{Value: value64(t, 0xc0000000b)},
 				},
 			},
 			1,
@@ -191,32 +221,32 @@ func TestSyscallCompile(t *testing.T) {
 			"amd64",
 			[]bpf.Instruction{
 				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 26, Val: 0},
-				lowlevel.LoadSeccompDataField("Arg5", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 24, Val: 11},
-				lowlevel.LoadSeccompDataField("Arg5", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 22, Val: 12},
-				lowlevel.LoadSeccompDataField("Arg4", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 20, Val: 9},
-				lowlevel.LoadSeccompDataField("Arg4", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 18, Val: 10},
-				lowlevel.LoadSeccompDataField("Arg3", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 16, Val: 7},
-				lowlevel.LoadSeccompDataField("Arg3", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 14, Val: 8},
-				lowlevel.LoadSeccompDataField("Arg2", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 12, Val: 5},
-				lowlevel.LoadSeccompDataField("Arg2", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 10, Val: 6},
-				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 8, Val: 3},
-				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 6, Val: 4},
 				lowlevel.LoadSeccompDataField("Arg0", false, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 4, Val: 1},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 23, Val: 1},
 				lowlevel.LoadSeccompDataField("Arg0", true, "amd64"),
-				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 2, Val: 2},
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 21, Val: 2},
+				lowlevel.LoadSeccompDataField("Arg1", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 19, Val: 3},
+				lowlevel.LoadSeccompDataField("Arg1", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 17, Val: 4},
+				lowlevel.LoadSeccompDataField("Arg2", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 15, Val: 5},
+				lowlevel.LoadSeccompDataField("Arg2", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 13, Val: 6},
+				lowlevel.LoadSeccompDataField("Arg3", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 11, Val: 7},
+				lowlevel.LoadSeccompDataField("Arg3", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 9, Val: 8},
+				lowlevel.LoadSeccompDataField("Arg4", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 7, Val: 9},
+				lowlevel.LoadSeccompDataField("Arg4", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 5, Val: 10},
+				lowlevel.LoadSeccompDataField("Arg5", false, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 3, Val: 11},
+				lowlevel.LoadSeccompDataField("Arg5", true, "amd64"),
+				bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 1, Val: 12},
+				bpf.Jump{Skip: 2},
 				lowlevel.LoadSeccompDataField("Number", false, "amd64"),
-				bpf.Jump{Skip: 1},
 			},
 		},
 		{
@@ -254,3 +284,46 @@ func TestSyscallCompile(t *testing.T) {
 		}
 	}
 }
+
+type TestCasesNewSyscallCallFilter struct {
+	arch     string
+	name     string
+	args     []SyscallArgument
+	expected SyscallCallFilter
+	err      bool
+}
+
+func TestNewSyscallCallFilter(t *testing.T) {
+	cases := []TestCasesNewSyscallCallFilter{
+		{
+			"amd64", "openat", nil,
+			SyscallCallFilter{Number: 257, Args: [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}},
+			false,
+		},
+		{
+			"arm64", "openat", []SyscallArgument{Equal(1), LessThan(2)},
+			SyscallCallFilter{Number: 56, Args: [6]SyscallArgument{Equal(1), LessThan(2), Any(), Any(), Any(), Any()}},
+			false,
+		},
+		{"arm64", "open", nil, SyscallCallFilter{}, true},
+		{"riscv", "clock_gettime", nil, SyscallCallFilter{}, true},
+		{"amd64", "read", make([]SyscallArgument, 7), SyscallCallFilter{}, true},
+	}
+	for i, tc := range cases {
+		got, err := NewSyscallCallFilter(tc.arch, tc.name, tc.args...)
+		if (err != nil) != tc.err || !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"[%d/%d] Expected '%+v' (error: %t) got '%+v' (%v)",
+				i+1, len(cases),
+				tc.expected, tc.err,
+				got, err,
+			)
+		}
+		if err != nil {
+			continue
+		}
+		if name, ok := got.Name(tc.arch); !ok || name != tc.name {
+			t.Errorf("[%d/%d] Expected name '%s' got '%s'", i+1, len(cases), tc.name, name)
+		}
+	}
+}
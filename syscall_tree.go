@@ -0,0 +1,109 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"math"
+	"sort"
+
+	"golang.org/x/net/bpf"
+)
+
+// syscallRule is a SyscallCallFilter along with the decision of its FilterElement
+type syscallRule struct {
+	filter   SyscallCallFilter
+	decision Decision
+}
+
+// compileTree produces a balanced binary decision tree over the sorted syscall
+// numbers of the elements, it expects the syscall number to be loaded.
+// Each leaf checks the rules of a single syscall number in the elements order,
+// so the first matching element still wins as in the linear form.
+func compileTree(elements []FilterElement, defaultDecision Decision, arch string) []bpf.Instruction {
+	rules := make(map[uint][]syscallRule)
+	var numbers []uint
+	for _, element := range elements {
+		for _, filter := range element.Match {
+			if _, ok := rules[filter.Number]; !ok {
+				numbers = append(numbers, filter.Number)
+			}
+			rules[filter.Number] = append(rules[filter.Number], syscallRule{filter, element.Decision})
+		}
+	}
+	if len(numbers) == 0 {
+		return []bpf.Instruction{defaultDecision.compile()}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return compileTreeNode(numbers, rules, defaultDecision, arch)
+}
+
+func compileTreeNode(numbers []uint, rules map[uint][]syscallRule, defaultDecision Decision, arch string) []bpf.Instruction {
+	if len(numbers) == 1 {
+		return compileTreeLeaf(numbers[0], rules[numbers[0]], defaultDecision, arch)
+	}
+	middle := len(numbers) / 2
+	left := compileTreeNode(numbers[:middle], rules, defaultDecision, arch)
+	right := compileTreeNode(numbers[middle:], rules, defaultDecision, arch)
+	instructions := []bpf.Instruction{
+		jumpIf(bpf.JumpGreaterThan, uint(len(left)), 0, uint32(numbers[middle-1])),
+	}
+	instructions = append(instructions, left...)
+	return append(instructions, right...)
+}
+
+func compileTreeLeaf(number uint, rules []syscallRule, defaultDecision Decision, arch string) []bpf.Instruction {
+	var body []bpf.Instruction
+	for _, rule := range rules {
+		checks := rule.filter.compileArgs(1, arch)
+		body = append(body, checks...)
+		body = append(body, rule.decision.compile())
+		if len(checks) == 0 {
+			// Next rules are unreachable
+			break
+		}
+	}
+	instructions := []bpf.Instruction{
+		jumpIf(bpf.JumpEqual, 0, uint(len(body)), uint32(number)),
+	}
+	instructions = append(instructions, body...)
+	return append(instructions, defaultDecision.compile())
+}
+
+// worstCaseLength returns the number of instructions executed on the longest
+// path of a program.
+func worstCaseLength(instructions []bpf.Instruction) int {
+	longest := make([]int, len(instructions)+1)
+	at := func(i int) int {
+		if i >= len(longest) {
+			return 0
+		}
+		return longest[i]
+	}
+	for i := len(instructions) - 1; i >= 0; i-- {
+		if _, ok := instructions[i].(bpf.RetConstant); ok {
+			longest[i] = 1
+			continue
+		}
+		if _, ok := instructions[i].(bpf.RetA); ok {
+			longest[i] = 1
+			continue
+		}
+		_, long := instructions[i].(longJumpIf)
+		targets := jumpTargets(instructions[i], i)
+		if targets == nil {
+			targets = []int{i + 1}
+		}
+		for _, target := range targets {
+			length := at(target)
+			// Far branches of long conditional jumps go through a trampoline
+			if long && target-i-1 > math.MaxUint8 {
+				length++
+			}
+			if length > longest[i] {
+				longest[i] = length
+			}
+		}
+		longest[i]++
+	}
+	return longest[0]
+}
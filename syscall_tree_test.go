@@ -0,0 +1,215 @@
+// SPDX-Licence-Identifier: MIT
+
+package goseccomp
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/diconico07/goseccomp/lowlevel"
+	"golang.org/x/net/bpf"
+)
+
+func TestCompileTree(t *testing.T) {
+	anyArgs := [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()}
+	elements := []FilterElement{
+		{
+			Match: []SyscallCallFilter{
+				{Number: 5, Args: anyArgs},
+				{Number: 1, Args: [6]SyscallArgument{Equal(2), Any(), Any(), Any(), Any(), Any()}},
+			},
+			Decision: Decision{Type: Errno, Data: 1},
+		},
+		{
+			Match:    []SyscallCallFilter{{Number: 3, Args: anyArgs}, {Number: 1, Args: anyArgs}},
+			Decision: Decision{Type: Allow},
+		},
+	}
+	expected := []bpf.Instruction{
+		bpf.JumpIf{Cond: bpf.JumpGreaterThan, SkipTrue: 6, Val: 1},
+		// 1
+		bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 4, Val: 1},
+		lowlevel.LoadSeccompDataField("Arg0", false, "386"),
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, SkipTrue: 1, Val: 2},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+		bpf.JumpIf{Cond: bpf.JumpGreaterThan, SkipTrue: 3, Val: 3},
+		// 3
+		bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 3},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ALLOW},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+		// 5
+		bpf.JumpIf{Cond: bpf.JumpEqual, SkipFalse: 1, Val: 5},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_ERRNO | 1},
+		bpf.RetConstant{Val: lowlevel.SECCOMP_RET_KILL_PROCESS},
+	}
+	got := compileTree(elements, Decision{Type: KillProcess}, "386")
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\n\tExpected: %+v\n\tGot:      %+v", expected, got)
+	}
+}
+
+type TestCasesWorstCaseLength struct {
+	instructions []bpf.Instruction
+	expected     int
+}
+
+func TestWorstCaseLength(t *testing.T) {
+	cases := []TestCasesWorstCaseLength{
+		{[]bpf.Instruction{bpf.RetConstant{}}, 1},
+		{
+			[]bpf.Instruction{
+				bpf.JumpIf{Cond: bpf.JumpEqual, SkipTrue: 2, Val: 1},
+				bpf.LoadConstant{},
+				bpf.RetConstant{},
+				bpf.RetConstant{},
+			},
+			3,
+		},
+		{
+			[]bpf.Instruction{
+				bpf.Jump{Skip: 2},
+				bpf.LoadConstant{},
+				bpf.LoadConstant{},
+				bpf.RetA{},
+			},
+			2,
+		},
+	}
+	for i, tc := range cases {
+		if got := worstCaseLength(tc.instructions); got != tc.expected {
+			t.Errorf("[%d/%d] Expected '%d' got '%d'", i+1, len(cases), tc.expected, got)
+		}
+	}
+}
+
+// seccompDataBigEndian builds the seccomp_data of a syscall as seen by a big endian
+// architecture, which is what the golang.org/x/net/bpf VM expects.
+func seccompDataBigEndian(number uint, args [6]uint64) []byte {
+	data := make([]byte, 64)
+	binary.BigEndian.PutUint32(data[0:], uint32(number))
+	binary.BigEndian.PutUint32(data[4:], lowlevel.GetAuditArch("s390x"))
+	for i, arg := range args {
+		binary.BigEndian.PutUint64(data[16+8*i:], arg)
+	}
+	return data
+}
+
+func TestCompileElementsSemantics(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	mask := value64(t, 0x100000001)
+	values := []uintptr{0, 1, 2, 3, value64(t, 0x100000000), 0xffffffff}
+	arguments := []func(uintptr) SyscallArgument{
+		Equal, NotEqual, LessThan, GreaterOrEqual,
+		func(v uintptr) SyscallArgument { return MaskedEqual(mask, v&mask) },
+	}
+	randomArgument := func() SyscallArgument {
+		if random.Intn(3) != 0 {
+			return Any()
+		}
+		return arguments[random.Intn(len(arguments))](values[random.Intn(len(values))])
+	}
+	decisions := []Decision{
+		{Type: Allow}, {Type: Errno, Data: 1}, {Type: Errno, Data: 2}, {Type: Trap},
+	}
+
+	for round := 0; round < 50; round++ {
+		var elements []FilterElement
+		for e := random.Intn(5); e >= 0; e-- {
+			element := FilterElement{Decision: decisions[random.Intn(len(decisions))]}
+			for m := random.Intn(60); m >= 0; m-- {
+				filter := SyscallCallFilter{Number: uint(random.Intn(40))}
+				for i := range filter.Args {
+					filter.Args[i] = randomArgument()
+				}
+				element.Match = append(element.Match, filter)
+			}
+			elements = append(elements, element)
+		}
+		defaultDecision := Decision{Type: KillProcess}
+
+		linear := []bpf.Instruction{lowlevel.LoadSeccompDataField("Number", false, "s390x")}
+		for _, element := range elements {
+			linear = append(linear, element.compile("s390x")...)
+		}
+		linear = append(linear, defaultDecision.compile())
+		tree := append(
+			[]bpf.Instruction{lowlevel.LoadSeccompDataField("Number", false, "s390x")},
+			compileTree(elements, defaultDecision, "s390x")...,
+		)
+		programs := map[string][]bpf.Instruction{"linear": linear, "tree": tree}
+		for name, program := range programs {
+			relaxed, err := relaxJumps(program)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			programs[name] = relaxed
+		}
+		difference, err := equivalent(programs["linear"], programs["tree"], "s390x")
+		if err != nil || difference != nil {
+			t.Errorf("[%d] Expected equivalent programs, got %+v (%v)", round, difference, err)
+		}
+
+		for call := 0; call < 200; call++ {
+			number := uint(random.Intn(42))
+			var args [6]uint64
+			for i := range args {
+				args[i] = uint64(values[random.Intn(len(values))])
+			}
+			expected := defaultDecision
+		OUTER:
+			for _, element := range elements {
+				for _, filter := range element.Match {
+					matches := filter.Number == number
+					for i, arg := range filter.Args {
+						matches = matches && arg.Matches(uintptr(args[i]))
+					}
+					if matches {
+						expected = element.Decision
+						break OUTER
+					}
+				}
+			}
+			for name, program := range programs {
+				vm, err := bpf.NewVM(program)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				got, err := vm.Run(seccompDataBigEndian(number, args))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if uint32(got) != expected.ToUint32() {
+					t.Errorf(
+						"[%d] %s: syscall %d %v: Expected '%x' got '%x'",
+						round, name, number, args, expected.ToUint32(), uint32(got),
+					)
+				}
+			}
+		}
+	}
+}
+
+func TestCompileElementsPicksTree(t *testing.T) {
+	var element FilterElement
+	for number := uint(0); number < 300; number++ {
+		element.Match = append(element.Match, SyscallCallFilter{
+			Number: number,
+			Args:   [6]SyscallArgument{Any(), Any(), Any(), Any(), Any(), Any()},
+		})
+	}
+	elements := []FilterElement{element}
+	got := worstCaseLength(compileElements(elements, Decision{Type: KillProcess}, "amd64"))
+	// 9 levels, two of them needing a long jump, then the leaf check and decision
+	if got != 13 {
+		t.Errorf("Expected a binary search, got %d instructions on the worst path", got)
+	}
+	small := []FilterElement{{Match: element.Match[:2]}}
+	got = worstCaseLength(compileElements(small, Decision{Type: KillProcess}, "amd64"))
+	if got != 3 {
+		t.Errorf("Expected linear checks, got %d instructions on the worst path", got)
+	}
+}